@@ -1,9 +1,17 @@
 package abm
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"math"
 	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // Agent states are stored as ints.
@@ -15,13 +23,100 @@ const (
 	Susceptible State = 0
 	Infected State = 1
 	Dead State = 2
+	Recovered State = 3
+	Exposed State = 4
+	Vaccinated State = 5
+	Quarantined State = 6
 )
 
+// The states in the order they are reported in.
+var report_states = []State{
+	Susceptible, Infected, Dead, Recovered, Exposed, Vaccinated,
+	Quarantined,
+}
+
+// Returns true if the state is one of the states defined above.
+func known(state State) bool {
+	for _, st := range report_states {
+		if st == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the state with the given name, as returned by String, in any
+// case.
+func ParseState(name string) (State, error) {
+	for _, state := range report_states {
+		if strings.EqualFold(name, state.String()) {
+			return state, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown state %q", name)
+}
+
+// Returns the name of the state, e.g. "Infected".
+func (state State) String() string {
+	switch state {
+	case Susceptible:
+		return "Susceptible"
+	case Infected:
+		return "Infected"
+	case Dead:
+		return "Dead"
+	case Recovered:
+		return "Recovered"
+	case Exposed:
+		return "Exposed"
+	case Vaccinated:
+		return "Vaccinated"
+	case Quarantined:
+		return "Quarantined"
+	}
+	return fmt.Sprintf("State(%d)", int(state))
+}
+
+
+// Output formats that Simulate can report in.
+type Format int
+
+const (
+	Text Format = 0
+	CSV Format = 1
+	JSONL Format = 2
+)
 
-// Holds an agent who has two attributes, a unique identity and a state.
+
+// Holds an agent with an identity, a state, an age, a position and an
+// infectiousness, and its infection history.
 type Agent struct {
 	identity int
 	state State
+	age int
+	infected_at int
+	x float64
+	y float64
+	infectiousness float64
+	secondary int
+	// The agent's states for the pathogens after the first.
+	strains []State
+	// The agent's most recent contacts, for contact tracing.
+	contacts []int
+	next_contact int
+	household int
+	// Between 0, none, and 1, full. Only used with WithImmunity.
+	immunity float64
+	contact_rate float64
+	// Only set with WithComorbidity.
+	comorbid bool
+	// The number of times the agent has been infected with the first
+	// pathogen, including at the start.
+	infections int
+	// The time from infected_at to death, once drawn. Only used with
+	// WithDeathTimes.
+	death_time float64
+	has_death_time bool
 }
 
 // Returns the agent state
@@ -29,46 +124,531 @@ func(a *Agent) State() State {
     return a.state
 }
 
+// Returns the agent's unique identity
+func(a *Agent) Identity() int {
+    return a.identity
+}
+
+// Returns the agent's age
+func(a *Agent) Age() int {
+    return a.age
+}
+
+// Returns the iteration at which the agent last became infected
+func(a *Agent) InfectedAt() int {
+    return a.infected_at
+}
+
+// Returns the probability that the agent infects someone it has
+// contact with while it is infected.
+func(a *Agent) Infectiousness() float64 {
+    return a.infectiousness
+}
+
+// Returns the number of agents that the agent has infected since it was
+// last infected itself.
+func(a *Agent) Secondary() int {
+    return a.secondary
+}
+
+// Returns the agent's immunity to the first pathogen, from 0 to 1. It
+// is always 0 unless immunity is turned on with WithImmunity.
+func(a *Agent) Immunity() float64 {
+    return a.immunity
+}
+
+// Returns true if the agent has a comorbidity, as set up by
+// WithComorbidity, which raises its death rate.
+func(a *Agent) Comorbid() bool {
+    return a.comorbid
+}
+
+// Returns the number of times the agent has been infected with the
+// first pathogen, counting an infection it started with.
+func(a *Agent) Infections() int {
+    return a.infections
+}
+
 // Creates a new agent with a unique identity number and an initial state
 func NewAgent(identity int, state State) Agent {
-	a := Agent{identity: identity, state: state}
+	a := Agent{identity: identity, state: state, infectiousness: 1.0,
+		contact_rate: 1.0}
 	return a
 }
 
-// Each simulation has a unique identity number and a slice of agents.
+// Each simulation has a unique identity number, a slice of agents and
+// its own random number generator.
 type Simulation struct {
 	identity int
 	agents []Agent
+	reinfection_factor float64
+	rng *rand.Rand
+	// The source behind rng, if the simulation created it.
+	src *pcgSource
+	// If set, the source that WithRandSource replaced rng with.
+	draws RandSource
+	format Format
+	report_interval int
+	collect_history bool
+	history History
+	ages AgeDistribution
+	network [][]int
+	cumulative_infections int
+	resolved int
+	resolved_secondary int
+	iteration int
+	metrics *MetricsCollector
+	iteration_counter *atomic.Int64
+	out io.Writer
+	space float64
+	infectiousness Distribution
+	ordered bool
+	hook Hook
+	max_agents int
+	pools [][]int
+	pool_pos []int
+	num_pathogens int
+	cross_immunity float64
+	pathogen_infections []int
+	log_events bool
+	events EventLog
+	seasonality Seasonality
+	trace_memory int
+	detected []int
+	iterations_run int
+	household_sizes HouseholdSizes
+	households [][]int
+	timing_log io.Writer
+	immunity_level float64
+	precision int
+	clustered bool
+	transmission float64
+	logger *slog.Logger
+	// Whether logger is enabled for the debug level.
+	log_timing bool
+	contact_rates Distribution
+	// The agents' contact rates, extended by Infect as agents are added,
+	// zeroed as they die and cleared when the population is refilled.
+	contact_weights weightTree
+	// The time spent in each event of the iterations being timed, and
+	// the names of the events.
+	phase_times []time.Duration
+	phase_names []string
+	comorbid_fraction float64
+	comorbid_multiplier float64
+	death_times Distribution
 }
 
+// Configures a simulation when it is constructed.
+type Option func(s *Simulation)
+
 
 // Creates a new simulation with a specified number of agents, with a
 // specified number of them initially infected.
-func NewSimulation(identity int, num_agents int, num_infections int) Simulation {
-	s := Simulation{identity: identity}
-	s.agents = make([]Agent, num_agents)
-	for i := 0; i < num_infections; i++ {
-		s.agents[i].identity = i
-		s.agents[i].state = Infected
-	}
-	for i := num_infections; i < len(s.agents); i++ {
-		s.agents[i].identity = i
-		s.agents[i].state = Susceptible
-	}
-	rand.Shuffle(len(s.agents), func(i, j int) {
-		s.agents[i], s.agents[j] = s.agents[j], s.agents[i]
-	})
+func NewSimulation(identity int, num_agents int, num_infections int,
+	options ...Option) Simulation {
+	return NewSimulationWithRand(identity, num_agents, num_infections, nil,
+		options...)
+}
+
+// Makes the simulation draw its random numbers from rng, which Save
+// cannot save.
+func WithRand(rng *rand.Rand) Option {
+	return func(s *Simulation) {
+		s.rng = rng
+		s.src = nil
+	}
+}
+
+// Creates a new simulation like NewSimulation but with the infected
+// agents first, in identity order, and the agents not shuffled.
+func NewSimulationOrdered(identity int, num_agents int, num_infections int,
+	options ...Option) Simulation {
+	ordered := func(s *Simulation) {
+		s.ordered = true
+	}
+	// Don't append into the caller's slice.
+	options = append(options[:len(options):len(options)], ordered)
+	return NewSimulation(identity, num_agents, num_infections, options...)
+}
+
+// Creates a new simulation like NewSimulation but returns an error if
+// the numbers of agents and infections are inconsistent.
+func NewSimulationChecked(identity int, num_agents int, num_infections int,
+	options ...Option) (Simulation, error) {
+	if num_agents < 0 {
+		return Simulation{}, fmt.Errorf(
+			"number of agents must not be negative, got %d", num_agents)
+	}
+	if num_infections < 0 {
+		return Simulation{}, fmt.Errorf(
+			"number of infections must not be negative, got %d",
+			num_infections)
+	}
+	if num_infections > num_agents {
+		return Simulation{}, fmt.Errorf(
+			"number of infections (%d) exceeds number of agents (%d)",
+			num_infections, num_agents)
+	}
+	return NewSimulation(identity, num_agents, num_infections, options...), nil
+}
+
+// Creates a new simulation whose agents start in the states given by
+// counts, which must add up to num_agents.
+func NewSimulationFromCounts(identity int, num_agents int,
+	counts map[State]int, options ...Option) (Simulation, error) {
+	total := 0
+	for state, count := range counts {
+		if !known(state) {
+			return Simulation{}, fmt.Errorf("unknown state %v", state)
+		}
+		if count < 0 {
+			return Simulation{}, fmt.Errorf(
+				"number of %v agents must not be negative, got %d",
+				state, count)
+		}
+		total += count
+	}
+	if total != num_agents {
+		return Simulation{}, fmt.Errorf(
+			"initial state counts add up to %d, not %d agents",
+			total, num_agents)
+	}
+	s := NewSimulation(identity, 0, 0, options...)
+	// Use a fixed order of states so that a seeded simulation is
+	// reproducible.
+	ordered := make([]stateCount, 0, len(counts))
+	for _, state := range report_states {
+		if counts[state] > 0 {
+			ordered = append(ordered, stateCount{state, counts[state]})
+		}
+	}
+	s.fill(ordered)
+	return s, nil
+}
+
+// Creates a new simulation whose agents each start in a state drawn with
+// the probabilities in probs.
+func NewSimulationFromProbabilities(identity int, num_agents int,
+	probs map[State]float64, options ...Option) (Simulation, error) {
+	if num_agents < 0 {
+		return Simulation{}, fmt.Errorf(
+			"number of agents must not be negative, got %d", num_agents)
+	}
+	total := 0.0
+	for state, prob := range probs {
+		if !known(state) {
+			return Simulation{}, fmt.Errorf("unknown state %v", state)
+		}
+		if prob < 0.0 || math.IsNaN(prob) {
+			return Simulation{}, fmt.Errorf(
+				"probability of %v must not be negative, got %g",
+				state, prob)
+		}
+		total += prob
+	}
+	if math.Abs(total - 1.0) > 1e-6 {
+		return Simulation{}, fmt.Errorf(
+			"initial state probabilities add up to %g, not 1", total)
+	}
+	s := NewSimulation(identity, 0, 0, options...)
+	// Use a fixed order of states so that a seeded simulation is
+	// reproducible.
+	ordered := make([]stateCount, 0, len(probs))
+	for _, state := range report_states {
+		if probs[state] > 0.0 {
+			ordered = append(ordered, stateCount{state, 0})
+		}
+	}
+	for range num_agents {
+		u := s.random().Float64() * total
+		k := 0
+		for ; k < len(ordered) - 1; k++ {
+			u -= probs[ordered[k].state]
+			if u < 0.0 {
+				break
+			}
+		}
+		ordered[k].count++
+	}
+	s.fill(ordered)
+	return s, nil
+}
+
+// Creates a new simulation in which exactly the agents with the given
+// identities start infected.
+func NewSimulationWithInfected(identity int, num_agents int, infected []int,
+	options ...Option) (Simulation, error) {
+	if num_agents < 0 {
+		return Simulation{}, fmt.Errorf(
+			"number of agents must not be negative, got %d", num_agents)
+	}
+	seen := make([]bool, num_agents)
+	for _, id := range infected {
+		if id < 0 || id >= num_agents {
+			return Simulation{}, fmt.Errorf(
+				"infected identity %d is not one of the %d agents",
+				id, num_agents)
+		}
+		if seen[id] {
+			return Simulation{}, fmt.Errorf(
+				"infected identity %d is given more than once", id)
+		}
+		seen[id] = true
+	}
+	s := NewSimulation(identity, num_agents, 0, options...)
+	for i := range s.agents {
+		if seen[s.agents[i].identity] {
+			s.agents[i].state = Infected
+			s.agents[i].infections = 1
+		}
+	}
+	s.cumulative_infections = len(infected)
+	s.rebuildPools()
+	return s, nil
+}
+
+// Creates a new simulation whose agents are exactly the given ones, in
+// the given order.
+func NewSimulationFromAgents(identity int, agents []Agent,
+	options ...Option) Simulation {
+	s := NewSimulation(identity, 0, 0, options...)
+	s.agents = agents
+	for i := range s.agents {
+		a := &s.agents[i]
+		if s.Pathogens() > 1 && len(a.strains) != s.Pathogens() - 1 {
+			a.strains = make([]State, s.Pathogens() - 1)
+		}
+		if a.state == Exposed || ill(a.state) {
+			s.cumulative_infections++
+			a.infections = max(a.infections, 1)
+		} else if a.state == Dead {
+			s.bury(i)
+		}
+	}
+	s.assignHouseholds()
+	s.rebuildPools()
+	return s
+}
+
+// Creates a new simulation like NewSimulation but with all random
+// numbers drawn from rng.
+func NewSimulationWithRand(identity int, num_agents int, num_infections int,
+	rng *rand.Rand, options ...Option) Simulation {
+	s := Simulation{identity: identity, rng: rng, report_interval: 100,
+		precision: -1, transmission: 1.0}
+	for _, option := range options {
+		option(&s)
+	}
+	if s.rng == nil {
+		s.setSource(newPCGSource(rand.Int63()))
+	}
+	s.populate(num_agents, num_infections)
 	return s
 }
 
+// Reinitializes the simulation with a new population, keeping its
+// settings and random number generator.
+func (s *Simulation) Reset(num_agents int, num_infections int) {
+	s.history = s.history[:0]
+	s.events = s.events[:0]
+	s.populate(num_agents, num_infections)
+}
+
+// Fills the agent slice with num_agents agents of which num_infections
+// are infected, in random order.
+func (s *Simulation) populate(num_agents int, num_infections int) {
+	s.fill([]stateCount{
+		{Infected, num_infections},
+		{Susceptible, num_agents - num_infections},
+	})
+}
+
+// The number of agents to start off in a state.
+type stateCount struct {
+	state State
+	count int
+}
+
+// Fills the agent slice with the given numbers of agents in each state,
+// in a random order.
+func (s *Simulation) fill(counts []stateCount) {
+	num_agents := 0
+	for _, c := range counts {
+		num_agents += c.count
+	}
+	if cap(s.agents) >= num_agents {
+		s.agents = s.agents[:num_agents]
+	} else {
+		s.agents = make([]Agent, num_agents)
+	}
+	s.cumulative_infections = 0
+	s.resolved = 0
+	s.resolved_secondary = 0
+	s.detected = s.detected[:0]
+	// The new agents have new contact rates.
+	s.contact_weights = weightTree{}
+	s.pathogen_infections = make([]int, s.Pathogens() - 1)
+	s.iteration = 0
+	i := 0
+	for _, c := range counts {
+		for j := 0; j < c.count; j++ {
+			s.agents[i] = NewAgent(i, c.state)
+			if c.state == Exposed || ill(c.state) {
+				s.agents[i].infections = 1
+			}
+			i++
+		}
+		if c.state == Exposed || ill(c.state) {
+			s.cumulative_infections += c.count
+		}
+	}
+	if s.ages != nil {
+		for i := range s.agents {
+			s.agents[i].age = s.ages(s.random())
+		}
+	}
+	for i := range s.agents {
+		s.initAgent(&s.agents[i])
+	}
+	if !s.ordered {
+		s.layoutRand().Shuffle(len(s.agents), func(i, j int) {
+			s.agents[i], s.agents[j] = s.agents[j], s.agents[i]
+		})
+	}
+	s.assignHouseholds()
+	if s.clustered {
+		s.clusterInfections()
+	}
+	s.rebuildPools()
+}
+
 
 // Getter function for a simulation's agents.
 func(s *Simulation) Agents() []Agent {
     return s.agents
 }
 
+// Returns the simulation's identity
+func(s *Simulation) Identity() int {
+    return s.identity
+}
+
+// Returns the total number of agents, living and dead
+func(s *Simulation) Len() int {
+    return len(s.agents)
+}
+
+// Returns the number of agents in the given state, in constant time.
+func (s *Simulation) count(state State) int {
+	if state < 0 || int(state) >= len(s.pools) {
+		return 0
+	}
+	return len(s.pools[state])
+}
+
+// Returns the fraction of all agents, living and dead, that are in the
+// given state, or 0 if there are no agents.
+func (s *Simulation) Fraction(state State) float64 {
+	if len(s.agents) == 0 {
+		return 0.0
+	}
+	return float64(s.count(state)) / float64(len(s.agents))
+}
+
+// Returns the fraction of the living agents that are in the given
+// state, or 0 if there are none.
+func (s *Simulation) FractionLiving(state State) float64 {
+	living := len(s.agents) - s.count(Dead)
+	if living == 0 || state == Dead {
+		return 0.0
+	}
+	return float64(s.count(state)) / float64(living)
+}
+
+// Sets whether recovered agents can be infected again
+func (s *Simulation) SetReinfection(enabled bool) {
+	if enabled {
+		s.reinfection_factor = 1.0
+	} else {
+		s.reinfection_factor = 0.0
+	}
+}
+
+// Sets how susceptible recovered agents are to reinfection, from 0 for
+// full immunity to 1 for none.
+func WithReinfection(factor float64) Option {
+	return func(s *Simulation) {
+		s.reinfection_factor = factor
+	}
+}
+
+// Sets the probability that a contact with an infected agent transmits
+// the infection. The default is 1.
+func WithTransmissionProbability(prob float64) Option {
+	return func(s *Simulation) {
+		s.transmission = prob
+	}
+}
+
+// Sets the format of the reports written by Simulate.
+func (s *Simulation) SetFormat(format Format) {
+	s.format = format
+}
+
+// A function that Simulate calls at the end of every iteration.
+type Hook func(s *Simulation, iteration int)
+
+// Sets a hook that Simulate calls at the end of every iteration
+func (s *Simulation) SetHook(hook Hook) {
+	s.hook = hook
+}
+
+// Sets the writer that Simulate reports to. The default is standard
+// output.
+func (s *Simulation) SetOutput(w io.Writer) {
+	s.out = w
+}
+
+// Sets the number of decimal places in text and CSV reports, or the
+// fewest needed if it is negative.
+func (s *Simulation) SetPrecision(digits int) {
+	s.precision = digits
+}
+
+// Formats a floating point value for a report, never in exponent form
+func (s *Simulation) formatFloat(x float64) string {
+	return strconv.FormatFloat(x, 'f', s.precision, 64)
+}
+
+// Sets how many iterations apart Simulate reports, or 0 for no reports
+func (s *Simulation) SetReportInterval(interval int) {
+	s.report_interval = interval
+}
+
+// Turns on the collection of Stats after every iteration of Simulate
+func (s *Simulation) EnableHistory() {
+	s.collect_history = true
+}
+
+// Returns the snapshots collected since EnableHistory was called.
+func (s *Simulation) History() []Stats {
+	return s.history
+}
+
+// Returns the probability that the agent is infected by a fully
+// infectious contact.
+func (s *Simulation) susceptibility(a *Agent) float64 {
+	return s.susceptibilityTo(a, 0)
+}
+
+// Returns true if the agent can be infected.
+func (s *Simulation) infectable(a *Agent) bool {
+	return s.susceptibility(a) > 0.0
+}
+
 // Counts the number of agents in a given state.
-func count_state(agents[] Agent, state State) int {
+func CountState(agents[] Agent, state State) int {
 	c := 0
 	for _, agent := range(agents) {
 		if agent.state == state {
@@ -80,81 +660,802 @@ func count_state(agents[] Agent, state State) int {
 
 
 // Counts the number of agents not in a given state.
-func count_not_state(agents[] Agent, state State) int {
-	c := count_state(agents, state)
+func CountNotState(agents[] Agent, state State) int {
+	c := CountState(agents, state)
 	return len(agents) - c
 }
 
+// Returns copies of the agents for which pred returns true, in order
+func (s *Simulation) Filter(pred func(Agent) bool) []Agent {
+	var agents []Agent
+	for i := range s.agents {
+		if pred(s.agents[i]) {
+			agents = append(agents, s.agents[i])
+		}
+	}
+	return agents
+}
+
+// Like Filter but returns the indices of the matching agents in the
+// slice returned by Agents, so that they can be looked up or changed.
+func (s *Simulation) FilterIndices(pred func(Agent) bool) []int {
+	var indices []int
+	for i := range s.agents {
+		if pred(s.agents[i]) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
 
-// Grows the number of agents in the simulation.
+// Counts the number of agents in every state in a single pass over the
+// agents. States with no agents are absent from the map.
+func CountByState(agents []Agent) map[State]int {
+	counts := make(map[State]int)
+	for i := range agents {
+		counts[agents[i].state]++
+	}
+	return counts
+}
+
+
+// The most agents, living and dead, that any simulation can grow to
+const MaxAgents = math.MaxInt32
+
+// Caps the total number of agents that Grow lets the simulation reach,
+// or 0 for no limit other than MaxAgents.
+func WithMaxAgents(max_agents int) Option {
+	return func(s *Simulation) {
+		s.max_agents = max_agents
+	}
+}
+
+// Returns the number of agents, living and dead, beyond which Grow adds
+// no more.
+func (s *Simulation) agentLimit() int {
+	if s.max_agents > 0 && s.max_agents < MaxAgents {
+		return s.max_agents
+	}
+	return MaxAgents
+}
+
+// Returns true if the simulation has as many agents as Grow allows, so
+// that it will not grow any more.
+func (s *Simulation) AtCapacity() bool {
+	return len(s.agents) >= s.agentLimit()
+}
+
+// Grows the number of agents in the simulation, up to the maximum set
+// with WithMaxAgents or MaxAgents.
 func (s *Simulation) Grow(growth_per_day float64) {
-	num_agents := count_not_state(s.agents, Dead)
-	new_agents := int(math.Round(growth_per_day * float64(num_agents)))
+	if growth_per_day == 0.0 {
+		return
+	}
+	num_agents := len(s.agents) - s.count(Dead)
 	n := len(s.agents)
+	growth := math.Round(growth_per_day * float64(num_agents))
+	// Capped while still a float, since converting a float too large
+	// for an int gives a meaningless result. NaN adds no agents.
+	new_agents := 0
+	if growth > 0.0 {
+		new_agents = int(min(growth, float64(max(s.agentLimit() - n, 0))))
+	}
 	for i := n; i < n + new_agents; i++ {
 		a := NewAgent(i, Susceptible)
+		s.initAgent(&a)
 		s.agents = append(s.agents, a)
+		s.addToPool(i)
+		s.joinHousehold(i)
+	}
+}
+
+// Draws the random attributes of an agent that is joining the
+// simulation, either at the start or through Grow.
+func (s *Simulation) initAgent(a *Agent) {
+	if s.space > 0.0 {
+		a.x = s.random().Float64() * s.space
+		a.y = s.random().Float64() * s.space
+	}
+	if s.infectiousness != nil {
+		a.infectiousness = s.infectiousness(s.random())
+	}
+	if s.contact_rates != nil {
+		a.contact_rate = s.contact_rates(s.random())
+	}
+	if s.comorbid_fraction > 0.0 {
+		a.comorbid = s.random().Float64() < s.comorbid_fraction
+	}
+	if s.Pathogens() > 1 {
+		a.strains = make([]State, s.Pathogens() - 1)
 	}
 }
 
-// Intentionally time consuming method to infect agents in the simulation.
+// Infects agents through the given number of random contacts, drawing
+// only the contacts between an infected and an infectable agent.
 func (s *Simulation) Infect(events int) {
-	for i := 0; i < events; i++ {
-		ind1 := rand.Intn(len(s.agents))
-		ind2 := rand.Intn(len(s.agents))
-		if s.agents[ind1].state == Susceptible &&
-			s.agents[ind2].state == Infected {
-			s.agents[ind1].state = Infected
-		} else if s.agents[ind2].state == Susceptible &&
-			s.agents[ind1].state == Infected {
-			s.agents[ind2].state = Infected
+	s.infect(s.seasonalEvents(events))
+}
+
+// Infect without seasonal forcing.
+func (s *Simulation) infect(events int) {
+	if len(s.agents) == 0 {
+		return
+	}
+	if s.contact_rates != nil {
+		s.infectWeighted(events)
+		return
+	}
+	n := float64(len(s.agents))
+	for events > 0 && len(s.pools[Infected]) > 0 {
+		susceptible := len(s.pools[Susceptible])
+		targets := susceptible
+		if s.reinfection_factor > 0.0 {
+			targets += len(s.pools[Recovered])
+		}
+		if targets == 0 {
+			return
+		}
+		infected := s.pools[Infected]
+		// Either agent of a pair can be the infected one.
+		p := 2.0 * float64(len(infected)) * float64(targets) / (n * n)
+		skip := geometric(s.random(), p)
+		if skip >= float64(events) {
+			return
+		}
+		events -= int(skip) + 1
+		infector := infected[s.random().Intn(len(infected))]
+		t := s.random().Intn(targets)
+		var target int
+		if t < susceptible {
+			target = s.pools[Susceptible][t]
+		} else {
+			target = s.pools[Recovered][t - susceptible]
+		}
+		s.recordContact(infector, target)
+		if s.transmits(s.random(), &s.agents[infector], &s.agents[target]) {
+			s.exposeBy(target, infector)
 		}
 	}
 }
 
-// Kills agents in the simulation, with death rates for susceptible
-// and infected agents differentiated.
-func (s *Simulation) Die(death_rate_susceptible float64,
-	death_rate_infected float64) {
+// Infects the agent at index i, moving it to the exposed state and
+// counting the infection.
+func (s *Simulation) expose(i int) {
+	s.setState(i, Exposed)
+	s.agents[i].secondary = 0
+	s.agents[i].infections++
+	s.cumulative_infections++
+}
+
+// Infects the agent at index i and credits the infection to the agent
+// at index infector.
+func (s *Simulation) exposeBy(i int, infector int) {
+	s.expose(i)
+	s.agents[infector].secondary++
+}
+
+// Moves the ill agent at index i to the given state, recovered or dead,
+// and adds the agents it infected to the tally used by EffectiveR.
+func (s *Simulation) resolve(i int, state State) {
+	s.resolved++
+	s.resolved_secondary += s.agents[i].secondary
+	s.setState(i, state)
+	if state == Recovered && s.immunity_level > 0.0 {
+		s.boostImmunity(&s.agents[i])
+	}
+}
+
+// Returns the mean number of agents infected by each agent whose
+// infection has ended, or 0 if none has.
+func (s *Simulation) EffectiveR() float64 {
+	if s.resolved == 0 {
+		return 0.0
+	}
+	return float64(s.resolved_secondary) / float64(s.resolved)
+}
+
+// Returns the number of infections since the simulation was created
+func (s *Simulation) CumulativeInfections() int {
+	return s.cumulative_infections
+}
+
+// Handles a contact between two agents, in which an infected one may
+// expose the other.
+func (s *Simulation) contact(ind1 int, ind2 int) {
+	s.recordContact(ind1, ind2)
+	if s.infectable(&s.agents[ind1]) &&
+		s.agents[ind2].state == Infected {
+		if s.transmits(s.random(), &s.agents[ind2], &s.agents[ind1]) {
+			s.exposeBy(ind1, ind2)
+		}
+	} else if s.infectable(&s.agents[ind2]) &&
+		s.agents[ind1].state == Infected {
+		if s.transmits(s.random(), &s.agents[ind1], &s.agents[ind2]) {
+			s.exposeBy(ind2, ind1)
+		}
+	}
+}
+
+// Decides whether an infected agent transmits to another agent during
+// a contact.
+func (s *Simulation) transmits(rng RandSource, infector *Agent,
+	target *Agent) bool {
+	prob := s.transmission * infector.infectiousness *
+		s.susceptibility(target)
+	if prob >= 1.0 {
+		return true
+	}
+	return rng.Float64() < prob
+}
+
+// Mass-action alternative to Infect, in which every susceptible agent is
+// exposed with probability 1 - exp(-transmission_rate * I / N). Each
+// infection is credited to an infected agent chosen in proportion to its
+// infectiousness.
+func (s *Simulation) InfectRate(transmission_rate float64) {
+	transmission_rate *= s.season()
+	num_living := CountNotState(s.agents, Dead)
+	if num_living == 0 {
+		return
+	}
+	infected := 0.0
+	var infectors []int
+	var weights []float64
+	for i := range s.agents {
+		if s.agents[i].state == Infected {
+			w := math.Min(s.agents[i].infectiousness, 1.0)
+			infected += w
+			infectors = append(infectors, i)
+			weights = append(weights, w)
+		}
+	}
+	force := transmission_rate * infected / float64(num_living)
+	if force <= 0.0 {
+		return
+	}
+	prob := 1.0 - math.Exp(-force)
+	var table aliasTable
+	for i := 0; i < len(s.agents); i++ {
+		sus := s.susceptibility(&s.agents[i])
+		if sus <= 0.0 {
+			continue
+		}
+		p := prob
+		if sus != 1.0 {
+			p = 1.0 - math.Exp(-force * sus)
+		}
+		if s.random().Float64() < p {
+			// Built on the first infection, so calls that infect nobody
+			// do not pay for it.
+			if table.len() == 0 {
+				table = newAliasTable(weights)
+			}
+			s.exposeBy(i, infectors[table.draw(s.random())])
+		}
+	}
+}
+
+// Vaccinates susceptible agents, up to the given fraction of the living
+// population.
+func (s *Simulation) Vaccinate(coverage float64) {
+	num_living := CountNotState(s.agents, Dead)
+	n := int(math.Round(coverage * float64(num_living)))
+	if n <= 0 {
+		return
+	}
+	// Copied because vaccinating agents removes them from the pool.
+	susceptible := append([]int(nil), s.pools[Susceptible]...)
+	if n > len(susceptible) {
+		n = len(susceptible)
+	}
+	// Partial Fisher-Yates shuffle to choose n of the susceptibles.
+	for i := 0; i < n; i++ {
+		j := i + s.random().Intn(len(susceptible) - i)
+		susceptible[i], susceptible[j] = susceptible[j], susceptible[i]
+		s.setState(susceptible[i], Vaccinated)
+	}
+}
+
+// Moves exposed agents to the infected state with the given probability
+func (s *Simulation) Progress(incubation_rate float64) {
+	rng := s.random()
+	for i := 0; i < len(s.agents); i++ {
+		if s.agents[i].state == Exposed {
+			if rng.Float64() < incubation_rate {
+				s.setState(i, Infected)
+				s.startIllness(&s.agents[i])
+			}
+		}
+	}
+}
+
+// Returns true for the states of agents who have the disease and are
+// ill, whether or not they are isolated.
+func ill(state State) bool {
+	return state == Infected || state == Quarantined
+}
+
+// Moves the given fraction of the infected agents to quarantine
+func (s *Simulation) Quarantine(detection_rate float64) {
+	rng := s.random()
+	for i := 0; i < len(s.agents); i++ {
+		if s.agents[i].state == Infected {
+			if rng.Float64() < detection_rate {
+				s.setState(i, Quarantined)
+				if s.trace_memory > 0 {
+					s.detected = append(s.detected, i)
+				}
+			}
+		}
+	}
+}
+
+// Moves infected and quarantined agents to the recovered state with
+// the given probability per iteration.
+func (s *Simulation) Recover(recovery_rate float64) {
+	rng := s.random()
+	for i := 0; i < len(s.agents); i++ {
+		if ill(s.agents[i].state) {
+			if rng.Float64() < recovery_rate {
+				s.resolve(i, Recovered)
+			}
+		}
+	}
+}
+
+// Recovers the infected and quarantined agents who have been infected
+// for at least the given number of iterations.
+func (s *Simulation) RecoverAfter(days int) {
+	for i := 0; i < len(s.agents); i++ {
+		if ill(s.agents[i].state) &&
+			s.iteration - s.agents[i].infected_at >= days {
+			s.resolve(i, Recovered)
+		}
+	}
+}
+
+// Moves recovered agents back to the susceptible state with the given
+// probability.
+func (s *Simulation) Wane(waning_rate float64) {
+	if s.immunity_level > 0.0 {
+		s.decayImmunity(waning_rate)
+	}
+	rng := s.random()
+	for i := 0; i < len(s.agents); i++ {
+		if s.agents[i].state == Recovered {
+			if rng.Float64() < waning_rate {
+				s.setState(i, Susceptible)
+			}
+		}
+	}
+}
+
+// Returns the probability per iteration that an agent of the given age
+// in the given state dies.
+type DeathRate func(age int, state State) float64
+
+// Returns a death rate that ignores age and depends only on whether the
+// agent is ill.
+func StateDeathRate(death_rate_susceptible float64,
+	death_rate_infected float64) DeathRate {
+	return func(age int, state State) float64 {
+		if ill(state) {
+			return death_rate_infected
+		}
+		return death_rate_susceptible
+	}
+}
+
+// Returns a death rate that ignores age and gives each state the rate
+// in rates. States missing from rates have a rate of 0.
+func StateMapDeathRate(rates map[State]float64) DeathRate {
+	// A slice indexed by state is much faster to look up than the map.
+	table := make([]float64, len(report_states))
+	for state, rate := range rates {
+		if known(state) {
+			table[state] = rate
+		}
+	}
+	return func(age int, state State) float64 {
+		if state < 0 || int(state) >= len(table) {
+			return 0.0
+		}
+		return table[state]
+	}
+}
+
+// Returns a death rate that combines death_rate with an independent
+// background rate.
+func AddBackgroundDeathRate(death_rate DeathRate,
+	background float64) DeathRate {
+	return func(age int, state State) float64 {
+		if state == Dead {
+			return 0.0
+		}
+		return 1.0 - (1.0 - death_rate(age, state)) * (1.0 - background)
+	}
+}
+
+// Returns the per-state death rates equivalent to StateDeathRate, for
+// callers moving from the two scalar rates to a map.
+func SusceptibleInfectedDeathRates(death_rate_susceptible float64,
+	death_rate_infected float64) map[State]float64 {
+	rates := make(map[State]float64)
+	for _, state := range report_states {
+		switch {
+		case state == Dead:
+		case ill(state):
+			rates[state] = death_rate_infected
+		default:
+			rates[state] = death_rate_susceptible
+		}
+	}
+	return rates
+}
+
+// Kills living agents in the simulation with the probability given by
+// death_rate.
+func (s *Simulation) Die(death_rate DeathRate) {
+	rng := s.random()
 	for i := 0; i < len(s.agents); i++ {
-		if s.agents[i].state == Susceptible {
-			if rand.Float64() < death_rate_susceptible {
-				s.agents[i].state = Dead
+		state := s.agents[i].state
+		if state == Dead {
+			continue
+		}
+		if s.death_times != nil && ill(state) && s.deathTimeReached(i) {
+			s.resolve(i, Dead)
+		} else if rng.Float64() < s.deathProbability(i, death_rate) {
+			if ill(state) {
+				s.resolve(i, Dead)
+			} else {
+				s.setState(i, Dead)
 			}
-		} else if s.agents[i].state == Infected {
-			if rand.Float64() < death_rate_infected {
-				s.agents[i].state = Dead
+		}
+	}
+}
+
+// Deterministic alternative to Die that kills exactly round(rate *
+// count) of the agents in each living state.
+func (s *Simulation) DieExpected(death_rate_susceptible float64,
+	death_rate_infected float64) {
+	for _, state := range report_states {
+		if state == Dead {
+			continue
+		}
+		rate := death_rate_susceptible
+		if ill(state) {
+			rate = death_rate_infected
+		}
+		// Copied because killing agents removes them from the pool.
+		pool := append([]int(nil), s.pools[state]...)
+		n := int(math.Round(rate * float64(len(pool))))
+		if n > len(pool) {
+			n = len(pool)
+		}
+		// Partial Fisher-Yates shuffle to choose the n that die.
+		for k := 0; k < n; k++ {
+			j := k + s.random().Intn(len(pool) - k)
+			pool[k], pool[j] = pool[j], pool[k]
+			if ill(state) {
+				s.resolve(pool[k], Dead)
+			} else {
+				s.setState(pool[k], Dead)
 			}
 		}
 	}
 }
 
-// Writes simulation statistics to standard output.
+// Holds the number of agents in each state at an iteration of a
+// simulation.
+type Stats struct {
+	SimulationID int `json:"simulation"`
+	Iteration int `json:"iteration"`
+	Susceptible int `json:"susceptible"`
+	Infected int `json:"infected"`
+	Dead int `json:"dead"`
+	Recovered int `json:"recovered"`
+	Exposed int `json:"exposed"`
+	Vaccinated int `json:"vaccinated"`
+	Quarantined int `json:"quarantined"`
+	CumulativeInfections int `json:"cumulative_infections"`
+	EffectiveR float64 `json:"effective_r"`
+}
+
+// Counts the agents in each state at the given iteration
+func (s *Simulation) Stats(iteration int) Stats {
+	st := Stats{
+		SimulationID: s.identity,
+		Iteration: iteration,
+		CumulativeInfections: s.cumulative_infections,
+		EffectiveR: s.EffectiveR(),
+	}
+	for i := range s.agents {
+		switch s.agents[i].state {
+		case Susceptible:
+			st.Susceptible++
+		case Infected:
+			st.Infected++
+		case Dead:
+			st.Dead++
+		case Recovered:
+			st.Recovered++
+		case Exposed:
+			st.Exposed++
+		case Vaccinated:
+			st.Vaccinated++
+		case Quarantined:
+			st.Quarantined++
+		}
+	}
+	return st
+}
+
+// A time series of statistics, one entry per iteration.
+type History []Stats
+
+// Returns the number of agents in the given state.
+func (st Stats) Count(state State) int {
+	switch state {
+	case Susceptible:
+		return st.Susceptible
+	case Infected:
+		return st.Infected
+	case Dead:
+		return st.Dead
+	case Recovered:
+		return st.Recovered
+	case Exposed:
+		return st.Exposed
+	case Vaccinated:
+		return st.Vaccinated
+	case Quarantined:
+		return st.Quarantined
+	}
+	return 0
+}
+
+// Writes simulation statistics to standard output
 func (s *Simulation) Report(iteration int) {
-	num_susceptible := count_state(s.agents, Susceptible)
-	num_infections := count_state(s.agents, Infected)
-	num_deaths := count_state(s.agents, Dead)
-	fmt.Println(
-		"Simulation:", s.identity,
-		"Iteration:", iteration,
-		"Susceptible", num_susceptible,
-		"Infections:", num_infections,
-		"Deaths:", num_deaths)
+	s.ReportTo(os.Stdout, iteration)
+}
+
+// Writes simulation statistics to w in the same format as Report.
+func (s *Simulation) ReportTo(w io.Writer, iteration int) {
+	st := s.Stats(iteration)
+	line := fmt.Sprintf("Simulation: %d Iteration: %d",
+		st.SimulationID, st.Iteration)
+	for _, state := range report_states {
+		line += fmt.Sprintf(" %v: %d", state, st.Count(state))
+	}
+	line += fmt.Sprintf(" Cumulative infections: %d Effective R: %s",
+		st.CumulativeInfections, s.formatFloat(st.EffectiveR))
+	if s.comorbid_fraction > 0.0 {
+		comorbid, dead := s.ComorbidCounts()
+		line += fmt.Sprintf(" Comorbid: %d Dead comorbid: %d", comorbid,
+			dead)
+	}
+	for k := 1; k < s.Pathogens(); k++ {
+		ps := s.PathogenStats(k)
+		line += fmt.Sprintf(" Pathogen %d Susceptible: %d Exposed: %d "+
+			"Infected: %d Recovered: %d Cumulative infections: %d", k,
+			ps.Susceptible, ps.Exposed, ps.Infected, ps.Recovered,
+			ps.CumulativeInfections)
+	}
+	fmt.Fprintln(w, line)
+}
+
+// Writes the column header for the lines written by ReportCSV.
+func ReportCSVHeader(w io.Writer) {
+	fmt.Fprintln(w, "simulation,iteration,susceptible,infected,dead,"+
+		"recovered,exposed,vaccinated,quarantined,cumulative_infections,"+
+		"effective_r")
+}
+
+// Writes simulation statistics to w as a single comma separated line.
+func (s *Simulation) ReportCSV(w io.Writer, iteration int) {
+	st := s.Stats(iteration)
+	fmt.Fprintf(w, "%d,%d,%d,%d,%d,%d,%d,%d,%d,%d,%s\n",
+		st.SimulationID,
+		st.Iteration,
+		st.Susceptible,
+		st.Infected,
+		st.Dead,
+		st.Recovered,
+		st.Exposed,
+		st.Vaccinated,
+		st.Quarantined,
+		st.CumulativeInfections,
+		s.formatFloat(st.EffectiveR))
+}
+
+// Writes simulation statistics in the format set by SetFormat to the
+// writer set by SetOutput.
+func (s *Simulation) report(iteration int) {
+	w := s.out
+	if w == nil {
+		w = os.Stdout
+	}
+	s.ReportFormatted(w, iteration)
+	s.logReport(iteration)
+}
+
+// Writes simulation statistics to w in the format set by SetFormat
+func (s *Simulation) ReportFormatted(w io.Writer, iteration int) {
+	switch s.format {
+	case CSV:
+		s.ReportCSV(w, iteration)
+	case JSONL:
+		s.ReportJSONL(w, iteration)
+	default:
+		s.ReportTo(w, iteration)
+	}
+}
+
+// The per-iteration rates that drive a simulation.
+type Parameters struct {
+	Growth float64
+	Events int
+	// If set, the number of infection events in each iteration is drawn
+	// from it, with the simulation's random number generator, instead
+	// of being Events.
+	EventsDistribution CountDistribution
+	VaccinationRate float64
+	IncubationRate float64
+	DetectionRate float64
+	RecoveryRate float64
+	WaningRate float64
+	// The probability that each exposed or infected recent contact of a
+	// newly quarantined agent is traced and quarantined too. Only used
+	// if contact tracing is turned on with WithContactTracing.
+	TraceProbability float64
+	// The probability per iteration that an agent in each state dies.
+	// States that are missing never die. SusceptibleInfectedDeathRates
+	// builds the map from the two rates used by StateDeathRate.
+	DeathRates map[State]float64
+	// If set, used by Die instead of DeathRates.
+	DeathRate DeathRate
+	// The probability per iteration that any living agent, whatever its
+	// state, dies of causes other than the disease. It is combined with
+	// DeathRates or DeathRate by AddBackgroundDeathRate.
+	BackgroundDeathRate float64
+	// The rates of the pathogens after the first, in order. Pathogens
+	// beyond those set with WithPathogens are ignored.
+	Pathogens []PathogenParameters
+	// The probability that an infected agent infects each member of its
+	// household in an iteration. Only used with WithHouseholds.
+	HouseholdRate float64
+	// If true, Simulate stops at the end of the first iteration after
+	// which the epidemic has died out.
+	StopWhenExtinct bool
+	// If set, each iteration runs these strategies in order instead of
+	// the built-in sequence of events.
+	Strategies []EventStrategy
+}
+
+// The rates that drive a single iteration, as run by Step. They are the
+// same as those for Simulate, except that StopWhenExtinct is ignored.
+type StepParams = Parameters
+
+// Returns true if no agent is exposed to, infected with or quarantined
+// with any of the pathogens, so that there can be no more infections.
+func (s *Simulation) Extinct() bool {
+	if s.count(Exposed) > 0 || s.count(Infected) > 0 ||
+		s.count(Quarantined) > 0 {
+		return false
+	}
+	for k := 1; k < s.Pathogens(); k++ {
+		ps := s.PathogenStats(k)
+		if ps.Exposed > 0 || ps.Infected > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the number of iterations the last call to Simulate ran
+func (s *Simulation) IterationsRun() int {
+	return s.iterations_run
+}
+
+// Returns the number of the iteration that the next call to Step runs.
+func (s *Simulation) Iteration() int {
+	return s.iteration
+}
+
+// Runs a single iteration of the simulation and returns the resulting
+// statistics.
+func (s *Simulation) Step(p StepParams) Stats {
+	i := s.iteration
+	s.step(p, StateMapDeathRate(p.DeathRates))
+	return s.Stats(i)
+}
+
+// Runs iteration s.iteration, killing agents with death_rate if
+// p.DeathRate is not set, and advances to the next iteration.
+func (s *Simulation) step(p StepParams, death_rate DeathRate) {
+	strategies := p.Strategies
+	if strategies == nil {
+		strategies = defaultStrategies(p, death_rate)
+	}
+	i := s.iteration
+	s.apply(strategies, i)
+	if s.collect_history || s.metrics != nil {
+		st := s.Stats(i)
+		if s.collect_history {
+			s.history = append(s.history, st)
+		}
+		if s.metrics != nil {
+			s.metrics.Record(st)
+		}
+	}
+	if s.iteration_counter != nil {
+		s.iteration_counter.Add(1)
+	}
+	s.iteration = i + 1
 }
 
 // Simulation engine that repeatedly executes the events the specified
-// number of iterations.
-func (s *Simulation) Simulate(iterations int,
-	growth_per_day float64,
-	events int,
-	death_rate_susceptible float64,
-	death_rate_infected float64) {
+// number of iterations, until ctx is cancelled. Passing
+// context.Background() runs all the iterations.
+func (s *Simulation) Simulate(ctx context.Context, iterations int,
+	p Parameters) error {
+	return s.simulate(ctx, iterations, p, nil, nil)
+}
+
+// Like Simulate but the number of infection events in each iteration
+// is obtained by calling events_func.
+func (s *Simulation) SimulateFunc(ctx context.Context, iterations int,
+	p Parameters, events_func func(iteration int) int) error {
+	return s.simulate(ctx, iterations, p, events_func, nil)
+}
+
+// Runs the iterations of Simulate, SimulateFunc and SimulateControlled
+func (s *Simulation) simulate(ctx context.Context, iterations int,
+	p Parameters, events_func func(iteration int) int,
+	control <-chan Control) error {
+	// Built once rather than by each step.
+	death_rate := StateMapDeathRate(p.DeathRates)
+	s.iterations_run = 0
+	// The first iteration whose timings have not been logged.
+	logged := 0
+	defer func() {
+		if s.iterations_run > logged {
+			s.logTiming(logged, s.iterations_run - 1)
+		}
+	}()
 	for i := range(iterations) {
-		s.Grow(growth_per_day)
-		s.Infect(events)
-		s.Die(death_rate_susceptible, death_rate_infected)
-		if i % 100 == 0 {
-			s.Report(i)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if control != nil {
+			var stop bool
+			var err error
+			stop, control, err = awaitControl(ctx, control)
+			if err != nil {
+				return err
+			}
+			if stop {
+				return nil
+			}
+		}
+		s.iteration = i
+		if events_func != nil {
+			p.Events = events_func(i)
+			p.EventsDistribution = nil
+		}
+		s.step(p, death_rate)
+		if s.report_interval > 0 && i % s.report_interval == 0 {
+			s.report(i)
+			s.logTiming(logged, i)
+			logged = i + 1
+		}
+		if s.hook != nil {
+			s.hook(s, i)
+		}
+		s.iterations_run = i + 1
+		if p.StopWhenExtinct && s.Extinct() {
+			break
 		}
 	}
+	return nil
 }
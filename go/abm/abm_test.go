@@ -0,0 +1,482 @@
+package abm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Agent counts the benchmarks are run with.
+var benchmarkSizes = []int{10000, 100000, 1000000}
+
+// The default rates used by runsim.
+var benchmarkParameters = Parameters{
+	Growth: 0.0001,
+	Events: 20,
+	IncubationRate: 1.0,
+	DeathRates: SusceptibleInfectedDeathRates(0.0001, 0.001),
+}
+
+// Creates a reproducible simulation with one percent of the agents
+// initially infected.
+func newBenchmarkSimulation(num_agents int) Simulation {
+	rng := rand.New(rand.NewSource(1))
+	s := NewSimulationWithRand(0, num_agents, num_agents / 100, rng)
+	s.SetReportInterval(0)
+	return s
+}
+
+// Runs f as a sub-benchmark for each of the benchmark sizes.
+func runSizes(b *testing.B, f func(b *testing.B, num_agents int)) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("agents=%d", n), func(b *testing.B) {
+			f(b, n)
+		})
+	}
+}
+
+func BenchmarkInfect(b *testing.B) {
+	runSizes(b, func(b *testing.B, num_agents int) {
+		s := newBenchmarkSimulation(num_agents)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// Each iteration starts from the initial infections, as
+			// the population is otherwise soon all infected.
+			b.StopTimer()
+			s.Reset(num_agents, num_agents / 100)
+			b.StartTimer()
+			s.Infect(num_agents)
+		}
+	})
+}
+
+func BenchmarkInfectParallel(b *testing.B) {
+	runSizes(b, func(b *testing.B, num_agents int) {
+		s := newBenchmarkSimulation(num_agents)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// Each iteration starts from the initial infections, as
+			// the population is otherwise soon all infected.
+			b.StopTimer()
+			s.Reset(num_agents, num_agents / 100)
+			b.StartTimer()
+			s.InfectParallel(num_agents, 4)
+		}
+	})
+}
+
+func BenchmarkDie(b *testing.B) {
+	runSizes(b, func(b *testing.B, num_agents int) {
+		s := newBenchmarkSimulation(num_agents)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			s.Die(StateDeathRate(0, 0))
+		}
+	})
+}
+
+func BenchmarkGrow(b *testing.B) {
+	runSizes(b, func(b *testing.B, num_agents int) {
+		s := newBenchmarkSimulation(num_agents)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			s.Grow(0.01)
+			// Drop the new agents so every iteration grows the
+			// same population.
+			truncateAgents(&s, num_agents)
+		}
+	})
+}
+
+// Removes the agents from index n onwards, keeping the pools up to
+// date.
+func truncateAgents(s *Simulation, n int) {
+	for i := len(s.agents) - 1; i >= n; i-- {
+		s.removeFromPool(i)
+	}
+	s.agents = s.agents[:n]
+	s.pool_pos = s.pool_pos[:n]
+}
+
+func BenchmarkSimulate(b *testing.B) {
+	runSizes(b, func(b *testing.B, num_agents int) {
+		ctx := context.Background()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			s := newBenchmarkSimulation(num_agents)
+			b.StartTimer()
+			s.Simulate(ctx, 100, benchmarkParameters)
+		}
+	})
+}
+
+// Returns the total number of agents counted across all states.
+func statsTotal(st Stats) int {
+	return st.Susceptible + st.Exposed + st.Infected + st.Recovered +
+		st.Dead + st.Vaccinated + st.Quarantined
+}
+
+// Creates a small reproducible simulation for the tests, with the given
+// options, that does not report.
+func newTestSimulation(num_agents int, num_infections int,
+	options ...Option) Simulation {
+	options = append([]Option{WithSeed(42)}, options...)
+	s := NewSimulation(0, num_agents, num_infections, options...)
+	s.SetReportInterval(0)
+	return s
+}
+
+func TestConservationOfAgents(t *testing.T) {
+	s := newTestSimulation(1000, 100)
+	steps := []struct {
+		name string
+		f func()
+	}{
+		{"Infect", func() { s.Infect(1000) }},
+		{"Progress", func() { s.Progress(0.5) }},
+		{"Quarantine", func() { s.Quarantine(0.3) }},
+		{"Recover", func() { s.Recover(0.2) }},
+		{"Wane", func() { s.Wane(0.1) }},
+		{"Die", func() { s.Die(StateDeathRate(0.05, 0.2)) }},
+	}
+	for i := 0; i < 20; i++ {
+		for _, step := range steps {
+			step.f()
+			st := s.Stats(i)
+			if total := statsTotal(st); total != len(s.agents) {
+				t.Fatalf("iteration %d: after %s states sum to %d, "+
+					"want %d", i, step.name, total, len(s.agents))
+			}
+		}
+	}
+}
+
+func TestGrowOnlyAddsSusceptibles(t *testing.T) {
+	s := newTestSimulation(1000, 100)
+	s.Infect(1000)
+	s.Progress(0.5)
+	s.Recover(0.2)
+	s.Die(StateDeathRate(0.05, 0.2))
+	before := s.Stats(0)
+	s.Grow(0.1)
+	after := s.Stats(0)
+	if after.Susceptible <= before.Susceptible {
+		t.Fatalf("Grow did not add susceptibles: before %d, after %d",
+			before.Susceptible, after.Susceptible)
+	}
+	before.Susceptible = after.Susceptible
+	if before != after {
+		t.Fatalf("Grow changed non-susceptible counts: before %+v, "+
+			"after %+v", before, after)
+	}
+	if total := statsTotal(after); total != len(s.agents) {
+		t.Fatalf("states sum to %d, want %d", total, len(s.agents))
+	}
+}
+
+func TestBackgroundDeathRate(t *testing.T) {
+	rate := AddBackgroundDeathRate(StateDeathRate(0.5, 0.8), 0.5)
+	if got := rate(30, Susceptible); got != 0.75 {
+		t.Fatalf("got susceptible rate %g, want 0.75", got)
+	}
+	if got := rate(30, Infected); math.Abs(got - 0.9) > 1e-12 {
+		t.Fatalf("got infected rate %g, want 0.9", got)
+	}
+	if got := rate(30, Dead); got != 0 {
+		t.Fatalf("got dead rate %g, want 0", got)
+	}
+	s := newTestSimulation(10000, 0)
+	s.Simulate(context.Background(), 10, Parameters{
+		BackgroundDeathRate: 0.1,
+	})
+	// 10000 * (1 - 0.9^10) is about 6513.
+	if dead := s.Stats(10).Dead; dead < 6300 || dead > 6700 {
+		t.Fatalf("got %d dead, want about 6513", dead)
+	}
+	checkPools(t, &s, "Simulate")
+}
+
+func TestGrowExcludesDead(t *testing.T) {
+	s, err := NewSimulationFromCounts(0, 1000, map[State]int{
+		Dead: 400,
+		Infected: 100,
+		Susceptible: 500,
+	}, WithRand(rand.New(rand.NewSource(42))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Grow(0.1)
+	// 10% of the 600 living agents, not of all 1000.
+	if got := CountState(s.Agents(), Susceptible); got != 560 {
+		t.Fatalf("Grow left %d susceptibles, want 560", got)
+	}
+	if s.Len() != 1060 {
+		t.Fatalf("Grow left %d agents, want 1060", s.Len())
+	}
+}
+
+func TestStepMatchesSimulate(t *testing.T) {
+	p := Parameters{
+		Growth: 0.001,
+		Events: 500,
+		IncubationRate: 0.5,
+		RecoveryRate: 0.1,
+		DeathRates: SusceptibleInfectedDeathRates(0.001, 0.01),
+	}
+	s := newTestSimulation(1000, 10)
+	s.Simulate(context.Background(), 20, p)
+	stepped := newTestSimulation(1000, 10)
+	var st Stats
+	for stepped.Iteration() < 20 {
+		st = stepped.Step(p)
+	}
+	if want := s.Stats(19); st != want {
+		t.Fatalf("stepping ended with %+v, want %+v", st, want)
+	}
+}
+
+func TestNewSimulationFromAgents(t *testing.T) {
+	agents := []Agent{
+		NewAgent(0, Susceptible),
+		NewAgent(1, Infected),
+		NewAgent(2, Recovered),
+		NewAgent(3, Dead),
+	}
+	s := NewSimulationFromAgents(0, agents, WithSeed(1))
+	s.SetReportInterval(0)
+	for i, a := range s.Agents() {
+		if a.Identity() != i || a.State() != agents[i].State() {
+			t.Fatalf("agent %d is %d, %v; want %d, %v", i, a.Identity(),
+				a.State(), i, agents[i].State())
+		}
+	}
+	checkPools(t, &s, "NewSimulationFromAgents")
+	if got := s.CumulativeInfections(); got != 1 {
+		t.Fatalf("got %d initial infections, want 1", got)
+	}
+	// The only contact that can transmit is between agents 0 and 1,
+	// which enough events are all but certain to include.
+	s.Infect(1000)
+	if st := s.Agents()[0].State(); st != Exposed {
+		t.Fatalf("after Infect agent 0 is %v, want Exposed", st)
+	}
+}
+
+func TestNewSimulationFromProbabilities(t *testing.T) {
+	probs := map[State]float64{Susceptible: 0.7, Infected: 0.1,
+		Recovered: 0.2}
+	s, err := NewSimulationFromProbabilities(0, 10000, probs, WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPools(t, &s, "NewSimulationFromProbabilities")
+	st := s.Stats(0)
+	if st.Susceptible + st.Infected + st.Recovered != 10000 {
+		t.Fatalf("got %+v, want only susceptible, infected and "+
+			"recovered agents", st)
+	}
+	for state, prob := range probs {
+		if n := float64(st.Count(state)); math.Abs(n - 10000 * prob) >
+			200 {
+			t.Fatalf("got %g %v agents, want about %g", n, state,
+				10000 * prob)
+		}
+	}
+	if st.CumulativeInfections != st.Infected {
+		t.Fatalf("got %d initial infections, want %d",
+			st.CumulativeInfections, st.Infected)
+	}
+	for _, bad := range []map[State]float64{
+		{Susceptible: 0.5},
+		{Susceptible: 1.5, Infected: -0.5},
+		{State(99): 1.0},
+	} {
+		_, err := NewSimulationFromProbabilities(0, 100, bad)
+		if err == nil {
+			t.Fatalf("probabilities %v gave no error", bad)
+		}
+	}
+}
+
+func TestNewSimulationWithInfected(t *testing.T) {
+	infected := []int{3, 141, 59, 26}
+	s, err := NewSimulationWithInfected(0, 1000, infected, WithSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[int]bool)
+	for _, id := range infected {
+		want[id] = true
+	}
+	for _, a := range s.Agents() {
+		if (a.State() == Infected) != want[a.Identity()] {
+			t.Fatalf("agent %d is %v", a.Identity(), a.State())
+		}
+	}
+	checkPools(t, &s, "NewSimulationWithInfected")
+	if got := s.CumulativeInfections(); got != len(infected) {
+		t.Fatalf("got %d initial infections, want %d", got,
+			len(infected))
+	}
+	for _, bad := range [][]int{{1000}, {-1}, {5, 5}} {
+		if _, err := NewSimulationWithInfected(0, 1000, bad); err == nil {
+			t.Fatalf("infected identities %v gave no error", bad)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	s := newTestSimulation(1000, 100)
+	infected := func(a Agent) bool { return a.State() == Infected }
+	agents := s.Filter(infected)
+	indices := s.FilterIndices(infected)
+	if len(agents) != 100 || len(indices) != 100 {
+		t.Fatalf("got %d agents and %d indices, want 100", len(agents),
+			len(indices))
+	}
+	for k, i := range indices {
+		if s.Agents()[i].Identity() != agents[k].Identity() {
+			t.Fatalf("index %d is agent %d, want agent %d", i,
+				s.Agents()[i].Identity(), agents[k].Identity())
+		}
+	}
+}
+
+func TestGrowStopsAtLimit(t *testing.T) {
+	s := newTestSimulation(1000, 10)
+	s.Grow(math.NaN())
+	if s.Len() != 1000 {
+		t.Fatalf("Grow(NaN) left %d agents, want 1000", s.Len())
+	}
+	s.Grow(-0.5)
+	if s.Len() != 1000 {
+		t.Fatalf("negative growth left %d agents, want 1000", s.Len())
+	}
+	s = newTestSimulation(1000, 10, WithMaxAgents(1500))
+	s.Grow(math.Inf(1))
+	if s.Len() != 1500 || !s.AtCapacity() {
+		t.Fatalf("infinite growth gave %d agents, want 1500 at capacity",
+			s.Len())
+	}
+	checkPools(t, &s, "Grow")
+}
+
+func TestZeroGrowthDoesNotAllocate(t *testing.T) {
+	s := newTestSimulation(1000, 100)
+	allocs := testing.AllocsPerRun(100, func() { s.Grow(0.0) })
+	if allocs != 0 {
+		t.Fatalf("Grow(0) made %g allocations, want 0", allocs)
+	}
+	if s.Len() != 1000 {
+		t.Fatalf("Grow(0) left %d agents, want 1000", s.Len())
+	}
+}
+
+func TestContactInfectsAtMostOne(t *testing.T) {
+	cases := []struct {
+		a, b State
+		reinfection float64
+		want [2]State
+	}{
+		{Susceptible, Infected, 0, [2]State{Exposed, Infected}},
+		{Infected, Susceptible, 0, [2]State{Infected, Exposed}},
+		{Infected, Infected, 0, [2]State{Infected, Infected}},
+		{Susceptible, Susceptible, 0, [2]State{Susceptible, Susceptible}},
+		{Recovered, Infected, 0, [2]State{Recovered, Infected}},
+		{Recovered, Infected, 1, [2]State{Exposed, Infected}},
+		{Infected, Recovered, 1, [2]State{Infected, Exposed}},
+		{Exposed, Infected, 1, [2]State{Exposed, Infected}},
+		{Vaccinated, Infected, 1, [2]State{Vaccinated, Infected}},
+		{Quarantined, Susceptible, 1, [2]State{Quarantined, Susceptible}},
+		{Dead, Infected, 1, [2]State{Dead, Infected}},
+		{Infected, Dead, 1, [2]State{Infected, Dead}},
+	}
+	// The ways of making the two agents meet once: directly, and through
+	// Infect with one event, whose draws are scripted so that the event
+	// pairs the agents.
+	meetings := []struct {
+		name string
+		meet func(t *testing.T, a, b State, reinfection float64) Simulation
+	}{
+		{"contact", func(t *testing.T, a, b State,
+			reinfection float64) Simulation {
+			s := NewSimulationFromAgents(0, []Agent{NewAgent(0, a),
+				NewAgent(1, b)}, WithReinfection(reinfection), WithSeed(1))
+			s.contact(0, 1)
+			return s
+		}},
+		{"Infect", func(t *testing.T, a, b State,
+			reinfection float64) Simulation {
+			s := NewSimulationFromAgents(0, []Agent{NewAgent(0, a),
+				NewAgent(1, b)}, WithReinfection(reinfection), WithSeed(1))
+			// Set after construction, which draws from the generator.
+			s.draws = &scriptedSource{t: t, floats: []float64{0.0},
+				ints: []int{0, 0}}
+			s.Infect(1)
+			return s
+		}},
+	}
+	for _, m := range meetings {
+		for _, c := range cases {
+			s := m.meet(t, c.a, c.b, c.reinfection)
+			got := [2]State{s.Agents()[0].State(), s.Agents()[1].State()}
+			if got != c.want {
+				t.Errorf("%s: %v and %v with reinfection %g became %v, "+
+					"want %v", m.name, c.a, c.b, c.reinfection, got, c.want)
+			}
+		}
+	}
+	// Whatever the states, a contact exposes at most one agent and
+	// changes no other state.
+	for _, m := range meetings {
+		for _, a := range report_states {
+			for _, b := range report_states {
+				checkMeeting(t, m.name, m.meet(t, a, b, 1), a, b)
+			}
+		}
+	}
+}
+
+// Checks that the meeting of agents in states a and b in s exposed at
+// most one of them and changed no other state.
+func checkMeeting(t *testing.T, name string, s Simulation, a, b State) {
+	t.Helper()
+	changed := 0
+	for i, before := range []State{a, b} {
+		if after := s.Agents()[i].State(); after != before {
+			changed++
+			if after != Exposed {
+				t.Errorf("%s of %v and %v made agent %d %v", name, a, b,
+					i, after)
+			}
+		}
+	}
+	if changed > 1 {
+		t.Errorf("%s of %v and %v changed both agents", name, a, b)
+	}
+	checkPools(t, &s, fmt.Sprintf("%s of %v and %v", name, a, b))
+}
+
+func TestTransmissionProbability(t *testing.T) {
+	const pairs = 10000
+	agents := make([]Agent, 2 * pairs)
+	for i := range agents {
+		agents[i] = NewAgent(i, Susceptible)
+		if i % 2 == 1 {
+			agents[i] = NewAgent(i, Infected)
+		}
+	}
+	s := NewSimulationFromAgents(0, agents, WithTransmissionProbability(0.3),
+		WithSeed(1))
+	for i := 0; i < len(agents); i += 2 {
+		s.contact(i, i + 1)
+	}
+	// 3000 expected, with a standard deviation of about 46.
+	if got := CountState(s.Agents(), Exposed); got < 2800 || got > 3200 {
+		t.Fatalf("%d of %d contacts transmitted, want about 3000", got,
+			pairs)
+	}
+}
@@ -0,0 +1,48 @@
+package abm
+
+// Draws the age of a new agent at the start of a simulation.
+type AgeDistribution func(rng RandSource) int
+
+// Sets the distribution that the ages of the initial agents are drawn
+// from. Agents added by Grow start at age 0.
+func WithAges(ages AgeDistribution) Option {
+	return func(s *Simulation) {
+		s.ages = ages
+	}
+}
+
+// Returns a distribution of ages uniform over min to max inclusive.
+func UniformAges(min int, max int) AgeDistribution {
+	return func(rng RandSource) int {
+		return min + rng.Intn(max - min + 1)
+	}
+}
+
+// One step of an age-stratified death rate, for agents up to and
+// including MaxAge.
+type AgeBracket struct {
+	MaxAge int
+	Susceptible float64
+	Infected float64
+}
+
+// Returns a step function death rate by age, from brackets in increasing
+// order of MaxAge.
+func AgeBracketDeathRate(brackets []AgeBracket) DeathRate {
+	return func(age int, state State) float64 {
+		if len(brackets) == 0 {
+			return 0.0
+		}
+		b := brackets[len(brackets) - 1]
+		for _, bracket := range brackets {
+			if age <= bracket.MaxAge {
+				b = bracket
+				break
+			}
+		}
+		if ill(state) {
+			return b.Infected
+		}
+		return b.Susceptible
+	}
+}
@@ -0,0 +1,67 @@
+package abm
+
+// A table for drawing indices with probability proportional to given
+// weights in constant time, by Vose's alias method.
+type aliasTable struct {
+	prob []float64
+	alias []int
+}
+
+// Builds an alias table for the given non-negative weights. If they are
+// all 0 every index is equally likely.
+func newAliasTable(weights []float64) aliasTable {
+	n := len(weights)
+	t := aliasTable{prob: make([]float64, n), alias: make([]int, n)}
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0.0 {
+		for i := range t.prob {
+			t.prob[i] = 1.0
+		}
+		return t
+	}
+	// Scale the weights to average 1 and split them into the columns
+	// that are too short and those that are too tall.
+	var small, large []int
+	for i, w := range weights {
+		t.prob[i] = w * float64(n) / total
+		if t.prob[i] < 1.0 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+	// Fill each short column from a tall one.
+	for len(small) > 0 && len(large) > 0 {
+		s := small[len(small) - 1]
+		small = small[:len(small) - 1]
+		l := large[len(large) - 1]
+		t.alias[s] = l
+		t.prob[l] -= 1.0 - t.prob[s]
+		if t.prob[l] < 1.0 {
+			large = large[:len(large) - 1]
+			small = append(small, l)
+		}
+	}
+	// Whatever is left is full, up to rounding errors.
+	for _, i := range append(small, large...) {
+		t.prob[i] = 1.0
+	}
+	return t
+}
+
+// Returns the number of indices in the table.
+func (t *aliasTable) len() int {
+	return len(t.prob)
+}
+
+// Draws an index.
+func (t *aliasTable) draw(rng RandSource) int {
+	i := rng.Intn(len(t.prob))
+	if rng.Float64() < t.prob[i] {
+		return i
+	}
+	return t.alias[i]
+}
@@ -0,0 +1,24 @@
+package abm
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestAliasTableMatchesWeights(t *testing.T) {
+	weights := []float64{1, 0, 3, 6}
+	table := newAliasTable(weights)
+	rng := rand.New(rand.NewSource(1))
+	counts := make([]int, len(weights))
+	const draws = 100000
+	for range draws {
+		counts[table.draw(rng)]++
+	}
+	for i, w := range weights {
+		want := w / 10 * draws
+		if d := float64(counts[i]) - want; d < -1000 || d > 1000 {
+			t.Fatalf("index %d drawn %d times, want about %g", i,
+				counts[i], want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package abm
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// The settings for a batch of simulations run by RunBatch.
+type BatchParams struct {
+	Simulations int
+	Iterations int
+	Agents int
+	Infections int
+	// The number of simulations to run at the same time. If it is less
+	// than 1 the number of CPUs is used. It is capped at Simulations.
+	Workers int
+	// Simulation i is seeded with Seed+i so that the whole batch is
+	// reproducible.
+	Seed int64
+	Parameters Parameters
+	// Applied to every simulation after its random number generator.
+	Options []Option
+	// If Output is set, each simulation reports to it every
+	// ReportInterval iterations, and once more at the end, in the given
+	// format. Reports from different simulations are never interleaved.
+	Output io.Writer
+	Format Format
+	ReportInterval int
+	// If set, each simulation reports instead to its own writer, which
+	// is closed once the simulation has finished.
+	OpenOutput func(sim_num int) (io.WriteCloser, error)
+	// If set, each simulation writes the time spent in each phase of its
+	// iterations to TimingLog every ReportInterval iterations, and at
+	// the end. Each line is written with a single call to Write.
+	TimingLog io.Writer
+	// If set, each simulation logs to it as described for SetLogger.
+	Logger *slog.Logger
+	// If set, called from the simulation's worker goroutine with the
+	// simulation's number once it has finished, e.g. to save its final
+	// state. An error stops the batch.
+	Finished func(sim_num int, s *Simulation) error
+	// If set, called with the number of completed simulations each time
+	// one completes. It is never called concurrently.
+	Progress func(completed int)
+	// If set, every simulation adds one to it after each iteration, as
+	// described for SetIterationCounter, e.g. for a progress display
+	// finer than Progress that polls it from another goroutine.
+	IterationCounter *atomic.Int64
+}
+
+// Runs a batch of simulations on a pool of worker goroutines and returns
+// the final statistics of each, ordered by simulation identity.
+func RunBatch(ctx context.Context, p BatchParams) ([]Stats, error) {
+	workers := p.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, p.Simulations)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var out lineWriter
+	var printed <-chan struct{}
+	if p.Output != nil && p.OpenOutput == nil {
+		out, printed = startPrinter(p.Output)
+	}
+	var wg sync.WaitGroup
+	var once sync.Once
+	var first error
+	jobs := make(chan int)
+	results := make(chan Stats)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sim_num := range jobs {
+				st, err := runOne(ctx, sim_num, &p, out)
+				if err != nil {
+					if ctx.Err() == nil {
+						once.Do(func() {
+							first = err
+							cancel()
+						})
+					}
+					continue
+				}
+				results <- st
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := 0; i < p.Simulations; i++ {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		if out != nil {
+			close(out)
+		}
+		close(results)
+	}()
+	var all []Stats
+	for st := range results {
+		all = append(all, st)
+		if p.Progress != nil {
+			p.Progress(len(all))
+		}
+	}
+	if printed != nil {
+		<-printed
+	}
+	slices.SortFunc(all, func(a, b Stats) int {
+		return a.SimulationID - b.SimulationID
+	})
+	if first != nil {
+		return all, first
+	}
+	// Only the caller's context can have been cancelled here.
+	return all, ctx.Err()
+}
+
+// Runs simulation number sim_num of the batch and returns its final
+// statistics.
+func runOne(ctx context.Context, sim_num int, p *BatchParams,
+	shared lineWriter) (st Stats, err error) {
+	options := append([]Option{WithSeed(p.Seed + int64(sim_num))},
+		p.Options...)
+	s, err := NewSimulationChecked(sim_num, p.Agents, p.Infections,
+		options...)
+	if err != nil {
+		return Stats{}, err
+	}
+	var out io.Writer
+	if p.OpenOutput != nil {
+		w, open_err := p.OpenOutput(sim_num)
+		if open_err != nil {
+			return Stats{}, open_err
+		}
+		defer func() {
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		out = w
+	} else if shared != nil {
+		out = shared
+	}
+	s.SetReportInterval(0)
+	s.SetTimingLog(p.TimingLog)
+	s.SetLogger(p.Logger)
+	s.SetIterationCounter(p.IterationCounter)
+	if out != nil {
+		s.SetOutput(out)
+		s.SetFormat(p.Format)
+	} else if p.Logger != nil {
+		// The reports are only logged.
+		s.SetOutput(io.Discard)
+	}
+	reporting := out != nil || p.Logger != nil
+	if reporting {
+		s.SetReportInterval(p.ReportInterval)
+	}
+	err = s.Simulate(ctx, p.Iterations, p.Parameters)
+	if err != nil {
+		return Stats{}, err
+	}
+	if reporting {
+		s.report(s.IterationsRun())
+	}
+	if p.Finished != nil {
+		if err := p.Finished(sim_num, &s); err != nil {
+			return Stats{}, err
+		}
+	}
+	return s.Stats(s.IterationsRun()), nil
+}
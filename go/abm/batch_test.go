@@ -0,0 +1,170 @@
+package abm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+// Runs a batch on several workers and returns the JSON encoding of the
+// history of every simulation. The reports are left out because the
+// order in which simulations running at once write them varies.
+func batchHistories(t *testing.T, options ...Option) []byte {
+	histories := make([][]Stats, 4)
+	_, err := RunBatch(context.Background(), BatchParams{
+		Simulations: len(histories),
+		Iterations: 50,
+		Agents: 2000,
+		Infections: 20,
+		Workers: 4,
+		Seed: 7,
+		Parameters: Parameters{
+			Growth: 0.001,
+			Events: 200,
+			VaccinationRate: 0.001,
+			IncubationRate: 0.2,
+			DetectionRate: 0.05,
+			TraceProbability: 0.5,
+			RecoveryRate: 0.1,
+			WaningRate: 0.01,
+			HouseholdRate: 0.05,
+			DeathRates: SusceptibleInfectedDeathRates(0.001, 0.01),
+		},
+		Options: append(options,
+			func(s *Simulation) { s.EnableHistory() }),
+		Finished: func(sim_num int, s *Simulation) error {
+			histories[sim_num] = s.History()
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(histories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// A buffer that records whether it has been closed.
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestBatchOpenOutput(t *testing.T) {
+	outputs := make([]*closeBuffer, 3)
+	_, err := RunBatch(context.Background(), BatchParams{
+		Simulations: len(outputs),
+		Iterations: 20,
+		Agents: 1000,
+		Infections: 10,
+		Workers: 2,
+		Parameters: benchmarkParameters,
+		Format: JSONL,
+		ReportInterval: 10,
+		OpenOutput: func(sim_num int) (io.WriteCloser, error) {
+			outputs[sim_num] = &closeBuffer{}
+			return outputs[sim_num], nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, out := range outputs {
+		if !out.closed {
+			t.Fatalf("output of simulation %d was not closed", i)
+		}
+		lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+		// Reports at iterations 0 and 10, and at the end.
+		if len(lines) != 3 {
+			t.Fatalf("simulation %d wrote %d lines, want 3", i,
+				len(lines))
+		}
+		for _, line := range lines {
+			var st Stats
+			if err := json.Unmarshal(line, &st); err != nil {
+				t.Fatal(err)
+			}
+			if st.SimulationID != i {
+				t.Fatalf("output of simulation %d has a report from %d",
+					i, st.SimulationID)
+			}
+		}
+	}
+}
+
+func TestBatchIterationCounter(t *testing.T) {
+	var counter atomic.Int64
+	_, err := RunBatch(context.Background(), BatchParams{
+		Simulations: 5,
+		Iterations: 20,
+		Agents: 1000,
+		Infections: 10,
+		Workers: 2,
+		Parameters: benchmarkParameters,
+		IterationCounter: &counter,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := counter.Load(); got != 5 * 20 {
+		t.Fatalf("counted %d iterations, want %d", got, 5 * 20)
+	}
+}
+
+func TestBatchCapsWorkers(t *testing.T) {
+	goroutines := 0
+	_, err := RunBatch(context.Background(), BatchParams{
+		Simulations: 1,
+		Iterations: 1,
+		Agents: 100,
+		Infections: 1,
+		Workers: 100000,
+		Parameters: benchmarkParameters,
+		Finished: func(sim_num int, s *Simulation) error {
+			goroutines = runtime.NumGoroutine()
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if goroutines > 100 {
+		t.Fatalf("%d goroutines ran one simulation", goroutines)
+	}
+}
+
+func TestSameSeedIsReproducible(t *testing.T) {
+	cases := []struct {
+		name string
+		options []Option
+	}{
+		{"default", nil},
+		{"transmission", []Option{WithTransmissionProbability(0.5),
+			WithInfectiousness(LogNormal(-0.5, 1.0))}},
+		{"contact rates", []Option{WithContactRates(LogNormal(-0.5,
+			1.0))}},
+		{"households", []Option{WithHouseholds(UniformHouseholdSizes(1,
+			6)), WithContactTracing(5), WithReinfection(0.5)}},
+		{"space", []Option{WithSpace(10.0),
+			WithClusteredInfections()}},
+	}
+	for _, c := range cases {
+		first := batchHistories(t, c.options...)
+		second := batchHistories(t, c.options...)
+		if !bytes.Equal(first, second) {
+			t.Fatalf("%s: two runs with the same seed differ", c.name)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package abm
+
+import (
+	"math/rand"
+)
+
+// Returns an independent copy of the simulation, with its own random
+// number generator seeded from the original's. The original's numbers
+// are unchanged unless it was given a generator by WithRand, which
+// cannot be copied and so is drawn from.
+func (s *Simulation) Clone() *Simulation {
+	c := *s
+	if s.src != nil {
+		c.setSource(newPCGSource(s.src.cloneSeed()))
+	} else {
+		c.rng = rand.New(rand.NewSource(s.rng.Int63()))
+	}
+	c.agents = append([]Agent(nil), s.agents...)
+	for i := range c.agents {
+		if s.agents[i].strains != nil {
+			c.agents[i].strains = append([]State(nil),
+				s.agents[i].strains...)
+		}
+		if s.agents[i].contacts != nil {
+			c.agents[i].contacts = append([]int(nil),
+				s.agents[i].contacts...)
+		}
+	}
+	c.detected = append([]int(nil), s.detected...)
+	c.households = make([][]int, len(s.households))
+	for h, members := range s.households {
+		c.households[h] = append([]int(nil), members...)
+	}
+	c.history = append(History(nil), s.history...)
+	c.events = append(EventLog(nil), s.events...)
+	if s.network != nil {
+		c.network = make([][]int, len(s.network))
+		for i, neighbours := range s.network {
+			c.network[i] = append([]int(nil), neighbours...)
+		}
+	}
+	c.pools = make([][]int, len(s.pools))
+	for st, pool := range s.pools {
+		c.pools[st] = append([]int(nil), pool...)
+	}
+	c.pool_pos = append([]int(nil), s.pool_pos...)
+	c.contact_weights = s.contact_weights.clone()
+	c.pathogen_infections = append([]int(nil), s.pathogen_infections...)
+	return &c
+}
@@ -0,0 +1,42 @@
+package abm
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestCloneIsIndependent(t *testing.T) {
+	s := newTestSimulation(1000, 100)
+	s.EnableHistory()
+	s.Simulate(context.Background(), 10, benchmarkParameters)
+	before := s.Stats(10)
+	c := s.Clone()
+	c.Simulate(context.Background(), 10, Parameters{
+		Events: 1000,
+		IncubationRate: 1.0,
+		RecoveryRate: 0.5,
+		DeathRates: map[State]float64{Infected: 0.1, Quarantined: 0.1},
+	})
+	if after := s.Stats(10); after != before {
+		t.Fatalf("running the clone changed the original: before %+v, "+
+			"after %+v", before, after)
+	}
+	if len(s.History()) != 10 {
+		t.Fatalf("original has %d history entries, want 10",
+			len(s.History()))
+	}
+	if &c.agents[0] == &s.agents[0] {
+		t.Fatal("clone shares the original's agents")
+	}
+	checkPools(t, c, "Clone")
+	// The original goes on as it would have without the clone.
+	w := newTestSimulation(1000, 100)
+	w.EnableHistory()
+	w.Simulate(context.Background(), 10, benchmarkParameters)
+	s.Simulate(context.Background(), 10, benchmarkParameters)
+	w.Simulate(context.Background(), 10, benchmarkParameters)
+	if !slices.Equal(s.History(), w.History()) {
+		t.Fatal("cloning changed the original's trajectory")
+	}
+}
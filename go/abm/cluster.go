@@ -0,0 +1,83 @@
+package abm
+
+import (
+	"math"
+	"sort"
+)
+
+// Seeds the initial infections in a cluster around a randomly chosen
+// agent rather than uniformly at random.
+func WithClusteredInfections() Option {
+	return func(s *Simulation) {
+		s.clustered = true
+	}
+}
+
+// Moves the initially infected agents to a cluster
+func (s *Simulation) clusterInfections() {
+	var infected []int
+	for i := range s.agents {
+		if s.agents[i].state == Infected {
+			infected = append(infected, i)
+		}
+	}
+	if len(infected) == 0 || len(infected) == len(s.agents) {
+		return
+	}
+	cluster := s.clusterOrder()[:len(infected)]
+	in_cluster := make(map[int]bool, len(cluster))
+	for _, i := range cluster {
+		in_cluster[i] = true
+	}
+	// Pair each infected agent outside the cluster with an agent in
+	// the cluster that is not infected.
+	k := 0
+	for _, i := range infected {
+		if in_cluster[i] {
+			continue
+		}
+		for s.agents[cluster[k]].state == Infected {
+			k++
+		}
+		j := cluster[k]
+		s.agents[i].state, s.agents[j].state = s.agents[j].state,
+			s.agents[i].state
+		s.agents[i].infections, s.agents[j].infections =
+			s.agents[j].infections, s.agents[i].infections
+		k++
+	}
+}
+
+// Returns the indices of all the agents, nearest first to a randomly
+// chosen agent.
+func (s *Simulation) clusterOrder() []int {
+	n := len(s.agents)
+	centre := s.random().Intn(n)
+	order := make([]int, n)
+	if s.space > 0.0 {
+		for i := range order {
+			order[i] = i
+		}
+		distance := make([]float64, n)
+		cx, cy := s.agents[centre].Position()
+		for i := range s.agents {
+			dx := torusDelta(s.agents[i].x, cx, s.space)
+			dy := torusDelta(s.agents[i].y, cy, s.space)
+			distance[i] = math.Hypot(dx, dy)
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return distance[order[a]] < distance[order[b]]
+		})
+		return order
+	}
+	// Households are runs of consecutive agents, so start at the
+	// first member of the chosen agent's.
+	start := centre
+	if len(s.households) > 0 {
+		start = s.households[s.agents[centre].household][0]
+	}
+	for k := range order {
+		order[k] = (start + k) % n
+	}
+	return order
+}
@@ -0,0 +1,23 @@
+package abm
+
+import "testing"
+
+func TestClusteredInfections(t *testing.T) {
+	s := newTestSimulation(1000, 30, WithClusteredInfections(),
+		WithHouseholds(UniformHouseholdSizes(4, 4)))
+	checkPools(t, &s, "WithClusteredInfections")
+	if got := CountState(s.Agents(), Infected); got != 30 {
+		t.Fatalf("got %d infected agents, want 30", got)
+	}
+	// 30 agents fill 7 households of 4 and half of the 8th.
+	households := make(map[int]bool)
+	for _, a := range s.Filter(func(a Agent) bool {
+		return a.State() == Infected
+	}) {
+		households[a.Household()] = true
+	}
+	if len(households) != 8 {
+		t.Fatalf("infected agents are in %d households, want 8",
+			len(households))
+	}
+}
@@ -0,0 +1,40 @@
+package abm
+
+// Gives each agent a comorbidity with the given probability, which
+// multiplies its death rate by death_multiplier.
+func WithComorbidity(fraction float64, death_multiplier float64) Option {
+	return func(s *Simulation) {
+		s.comorbid_fraction = fraction
+		s.comorbid_multiplier = death_multiplier
+	}
+}
+
+// Returns the probability that the agent at index i dies in this
+// iteration, given death_rate. With WithDeathTimes an ill agent's death
+// from the disease is scheduled, so it has the rate of a susceptible one.
+func (s *Simulation) deathProbability(i int, death_rate DeathRate) float64 {
+	a := &s.agents[i]
+	state := a.state
+	if s.death_times != nil && ill(state) {
+		state = Susceptible
+	}
+	rate := death_rate(a.age, state)
+	if a.comorbid {
+		rate *= s.comorbid_multiplier
+	}
+	return rate
+}
+
+// Returns the number of agents, living and dead, with a comorbidity and
+// the number of them that have died.
+func (s *Simulation) ComorbidCounts() (comorbid int, dead int) {
+	for i := range s.agents {
+		if s.agents[i].comorbid {
+			comorbid++
+			if s.agents[i].state == Dead {
+				dead++
+			}
+		}
+	}
+	return comorbid, dead
+}
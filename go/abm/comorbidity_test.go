@@ -0,0 +1,30 @@
+package abm
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestComorbidityRaisesDeaths(t *testing.T) {
+	s := newTestSimulation(10000, 0, WithComorbidity(0.2, 10.0))
+	s.Die(StateDeathRate(0.01, 0.01))
+	comorbid, dead := s.ComorbidCounts()
+	if comorbid < 1800 || comorbid > 2200 {
+		t.Fatalf("got %d comorbid agents, want about 2000", comorbid)
+	}
+	// About 0.1 of the comorbid agents die and 0.01 of the others.
+	if dead < 150 || dead > 250 {
+		t.Fatalf("got %d comorbid deaths, want about 200", dead)
+	}
+	if other := s.Stats(0).Dead - dead; other < 50 || other > 110 {
+		t.Fatalf("got %d other deaths, want about 80", other)
+	}
+	var buf bytes.Buffer
+	s.ReportTo(&buf, 0)
+	want := fmt.Sprintf("Comorbid: %d Dead comorbid: %d", comorbid, dead)
+	if !bytes.Contains(buf.Bytes(), []byte(want)) {
+		t.Fatalf("report %q does not contain %q", buf.String(), want)
+	}
+	checkPools(t, &s, "Die")
+}
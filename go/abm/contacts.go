@@ -0,0 +1,34 @@
+package abm
+
+// Gives each agent a contact rate drawn from rates, in proportion to
+// which Infect picks it for contacts.
+func WithContactRates(rates Distribution) Option {
+	return func(s *Simulation) {
+		s.contact_rates = rates
+	}
+}
+
+// Returns the agent's contact rate
+func(a *Agent) ContactRate() float64 {
+    return a.contact_rate
+}
+
+// Infect for contact rates set with WithContactRates
+func (s *Simulation) infectWeighted(events int) {
+	// Agents added since the last call join with their rates, and dead
+	// ones have a weight of 0, set by bury.
+	w := &s.contact_weights
+	for i := w.len(); i < len(s.agents); i++ {
+		if s.agents[i].state == Dead {
+			w.push(0.0)
+		} else {
+			w.push(s.agents[i].contact_rate)
+		}
+	}
+	if w.total <= 0.0 {
+		return
+	}
+	for i := 0; i < events; i++ {
+		s.contact(w.draw(s.random()), w.draw(s.random()))
+	}
+}
@@ -0,0 +1,74 @@
+package abm
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestContactRatesWeightInfections(t *testing.T) {
+	// Half the agents have ten times the contacts of the rest.
+	rates := func(rng RandSource) float64 {
+		if rng.Intn(2) == 0 {
+			return 10.0
+		}
+		return 1.0
+	}
+	s := newTestSimulation(10000, 100, WithContactRates(rates))
+	s.Infect(5000)
+	high, low := 0, 0
+	for _, a := range s.Agents() {
+		if a.State() == Exposed {
+			if a.ContactRate() == 10.0 {
+				high++
+			} else {
+				low++
+			}
+		}
+	}
+	if high < 5 * low {
+		t.Fatalf("%d agents with high and %d with low contact rates "+
+			"were infected, want about ten times as many high", high, low)
+	}
+	checkPools(t, &s, "Infect with contact rates")
+}
+
+func TestResetRebuildsContactWeights(t *testing.T) {
+	s := newTestSimulation(1000, 10, WithContactRates(LogNormal(0.0, 1.0)))
+	s.Infect(100)
+	s.Reset(1000, 10)
+	s.Infect(100)
+	weights := make([]float64, len(s.agents))
+	for i := range s.agents {
+		weights[i] = s.agents[i].contact_rate
+	}
+	if !slices.Equal(s.contact_weights.weights, weights) {
+		t.Fatal("Infect after Reset used the old contact rates")
+	}
+}
+
+func TestContactWeightsFollowDeathsAndGrowth(t *testing.T) {
+	s := newTestSimulation(1000, 10, WithContactRates(LogNormal(0.0, 1.0)))
+	s.Infect(100)
+	s.Die(StateDeathRate(0.5, 0.5))
+	s.Grow(0.1)
+	s.Infect(100)
+	if got := s.contact_weights.len(); got != len(s.agents) {
+		t.Fatalf("weights for %d agents, want %d", got, len(s.agents))
+	}
+	total := 0.0
+	for i := range s.agents {
+		want := s.agents[i].contact_rate
+		if s.agents[i].state == Dead {
+			want = 0.0
+		}
+		if got := s.contact_weights.weights[i]; got != want {
+			t.Fatalf("agent %d in state %v has weight %g, want %g", i,
+				s.agents[i].state, got, want)
+		}
+		total += want
+	}
+	if d := s.contact_weights.total - total; d < -1e-6 || d > 1e-6 {
+		t.Fatalf("total weight is %g, want %g", s.contact_weights.total,
+			total)
+	}
+}
@@ -0,0 +1,58 @@
+package abm
+
+import "context"
+
+// A message to a simulation run by SimulateControlled.
+type Control int
+
+// The messages that SimulateControlled acts on.
+const (
+	// Stop running iterations until Resume is sent.
+	Pause Control = iota
+	// Carry on after a Pause.
+	Resume
+	// Stop the simulation after the current iteration.
+	Stop
+)
+
+// Like Simulate but between iterations the messages sent on control
+// are acted on.
+func (s *Simulation) SimulateControlled(ctx context.Context,
+	iterations int, p Parameters, control <-chan Control) error {
+	return s.simulate(ctx, iterations, p, nil, control)
+}
+
+// Acts on any messages waiting on control, blocking while the
+// simulation is paused.
+func awaitControl(ctx context.Context, control <-chan Control) (bool,
+	<-chan Control, error) {
+	paused := false
+	for {
+		var msg Control
+		var ok bool
+		if paused {
+			select {
+			case <-ctx.Done():
+				return false, control, ctx.Err()
+			case msg, ok = <-control:
+			}
+		} else {
+			select {
+			case msg, ok = <-control:
+			default:
+				return false, control, nil
+			}
+		}
+		if !ok {
+			return false, nil, nil
+		}
+		switch msg {
+		case Pause:
+			paused = true
+		case Resume:
+			paused = false
+		case Stop:
+			return true, control, nil
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package abm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSimulateControlled(t *testing.T) {
+	s := newTestSimulation(1000, 10)
+	control := make(chan Control, 1)
+	paused := make(chan int)
+	// Pause before iterations 5 and 10, resuming after the first pause
+	// and stopping at the second.
+	s.SetHook(func(s *Simulation, iteration int) {
+		if iteration == 4 || iteration == 9 {
+			control <- Pause
+			paused <- iteration
+		}
+	})
+	done := make(chan error)
+	go func() {
+		done <- s.SimulateControlled(context.Background(), 100,
+			benchmarkParameters, control)
+	}()
+	<-paused
+	control <- Resume
+	<-paused
+	control <- Stop
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := s.IterationsRun(); got != 10 {
+		t.Fatalf("stopped after %d iterations, want 10", got)
+	}
+}
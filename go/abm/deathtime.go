@@ -0,0 +1,28 @@
+package abm
+
+// Sets the distribution of the time from infection to death, after which
+// Die kills an agent still ill. Until then it dies of other causes at the
+// rate of a susceptible agent.
+func WithDeathTimes(times Distribution) Option {
+	return func(s *Simulation) {
+		s.death_times = times
+	}
+}
+
+// Records that the agent became infected, i.e. infectious, in this
+// iteration, which starts the clock for WithDeathTimes.
+func (s *Simulation) startIllness(a *Agent) {
+	a.infected_at = s.iteration
+	a.has_death_time = false
+}
+
+// Returns true if the ill agent at index i has reached its time to
+// death, drawing the time if it does not have one yet.
+func (s *Simulation) deathTimeReached(i int) bool {
+	a := &s.agents[i]
+	if !a.has_death_time {
+		a.death_time = s.death_times(s.random())
+		a.has_death_time = true
+	}
+	return float64(s.iteration - a.infected_at) >= a.death_time
+}
@@ -0,0 +1,38 @@
+package abm
+
+import "testing"
+
+func TestDeathTimes(t *testing.T) {
+	// Every agent is infected at the start and dies after a time of
+	// about 10 iterations.
+	s := newTestSimulation(1000, 1000, WithDeathTimes(Gamma(100, 0.1)))
+	rate := StateDeathRate(0.0, 1.0)
+	for i := 0; i < 30; i++ {
+		s.Step(Parameters{DeathRate: rate})
+		dead := s.Stats(i).Dead
+		if i < 7 && dead > 0 {
+			t.Fatalf("%d agents died by iteration %d", dead, i)
+		}
+		if i > 16 && dead < 1000 {
+			t.Fatalf("only %d agents died by iteration %d", dead, i)
+		}
+	}
+	checkPools(t, &s, "Die")
+}
+
+func TestDeathTimesKeepOtherCauses(t *testing.T) {
+	// Nobody reaches a death time of about 1000 iterations, so deaths
+	// come from the background rate, doubled by the comorbidity.
+	s := newTestSimulation(1000, 1000, WithDeathTimes(Gamma(100, 10)),
+		WithComorbidity(1.0, 2.0))
+	p := Parameters{DeathRate: StateDeathRate(0.0, 1.0),
+		BackgroundDeathRate: 0.05}
+	for range 10 {
+		s.Step(p)
+	}
+	// The expected number dead is 1000 * (1 - 0.9^10), about 651.
+	if dead := s.Stats(9).Dead; dead < 600 || dead > 700 {
+		t.Fatalf("%d agents died, want about 651", dead)
+	}
+	checkPools(t, &s, "Die")
+}
@@ -0,0 +1,77 @@
+package abm
+
+import "math"
+
+// Draws a random value of an agent attribute.
+type Distribution func(rng RandSource) float64
+
+// Returns a lognormal distribution, i.e. exp(X) where X is normally
+// distributed with mean mu and standard deviation sigma.
+func LogNormal(mu float64, sigma float64) Distribution {
+	return func(rng RandSource) float64 {
+		return math.Exp(mu + sigma * rng.NormFloat64())
+	}
+}
+
+// Returns a gamma distribution with the given shape and scale
+func Gamma(shape float64, scale float64) Distribution {
+	if shape < 1.0 {
+		// Boosted from a shape of shape + 1, as Marsaglia and Tsang
+		// suggest.
+		boosted := Gamma(shape + 1.0, scale)
+		return func(rng RandSource) float64 {
+			return boosted(rng) * math.Pow(1.0 - rng.Float64(), 1.0 / shape)
+		}
+	}
+	d := shape - 1.0 / 3.0
+	c := 1.0 / math.Sqrt(9.0 * d)
+	return func(rng RandSource) float64 {
+		// Marsaglia and Tsang's method.
+		for {
+			x := rng.NormFloat64()
+			v := 1.0 + c * x
+			if v <= 0.0 {
+				continue
+			}
+			v = v * v * v
+			u := 1.0 - rng.Float64()
+			if math.Log(u) < 0.5 * x * x + d - d * v + d * math.Log(v) {
+				return d * v * scale
+			}
+		}
+	}
+}
+
+// Sets the distribution that each agent's infectiousness is drawn from
+func WithInfectiousness(infectiousness Distribution) Option {
+	return func(s *Simulation) {
+		s.infectiousness = infectiousness
+	}
+}
+
+// Draws a random count, such as the number of infection events in an
+// iteration.
+type CountDistribution func(rng RandSource) int
+
+// Returns a Poisson distribution with the given mean
+func PoissonEvents(mean float64) CountDistribution {
+	if mean <= 0.0 {
+		return func(rng RandSource) int { return 0 }
+	}
+	if mean >= 100.0 {
+		return func(rng RandSource) int {
+			n := math.Round(mean + math.Sqrt(mean) * rng.NormFloat64())
+			return int(math.Max(n, 0.0))
+		}
+	}
+	limit := math.Exp(-mean)
+	return func(rng RandSource) int {
+		// Knuth's method: count uniform draws until their product
+		// falls below exp(-mean).
+		n := 0
+		for prod := rng.Float64(); prod > limit; prod *= rng.Float64() {
+			n++
+		}
+		return n
+	}
+}
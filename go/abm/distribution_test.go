@@ -0,0 +1,28 @@
+package abm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestGammaMoments(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, shape := range []float64{0.5, 2.0, 9.0} {
+		gamma := Gamma(shape, 3.0)
+		var sum, sum_sq float64
+		n := 100000
+		for range n {
+			x := gamma(rng)
+			sum += x
+			sum_sq += x * x
+		}
+		mean := sum / float64(n)
+		variance := sum_sq / float64(n) - mean * mean
+		if math.Abs(mean - 3 * shape) > 0.05 * 3 * shape ||
+			math.Abs(variance - 9 * shape) > 0.1 * 9 * shape {
+			t.Fatalf("shape %g: got mean %g and variance %g, want %g "+
+				"and %g", shape, mean, variance, 3 * shape, 9 * shape)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package abm
+
+// Records a change in an agent's state.
+type Event struct {
+	Iteration int
+	Identity int
+	// The pathogen whose state changed, 0 unless more than one pathogen
+	// is circulating.
+	Pathogen int
+	From State
+	To State
+}
+
+// Every state change in a simulation, in the order they happened.
+type EventLog []Event
+
+// Turns on the logging of every change in an agent's state
+func (s *Simulation) EnableEventLog() {
+	s.log_events = true
+}
+
+// Returns the state changes logged since EnableEventLog was called.
+func (s *Simulation) Events() []Event {
+	return s.events
+}
+
+// Logs a change in the agent's state for the given pathogen if the
+// event log is enabled.
+func (s *Simulation) logEvent(a *Agent, pathogen int, from State,
+	to State) {
+	if s.log_events {
+		s.events = append(s.events, Event{
+			Iteration: s.iteration,
+			Identity: a.identity,
+			Pathogen: pathogen,
+			From: from,
+			To: to,
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package abm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEventLogReplaysStates(t *testing.T) {
+	s := newTestSimulation(1000, 100)
+	s.EnableEventLog()
+	states := make(map[int]State)
+	for _, a := range s.Agents() {
+		states[a.Identity()] = a.State()
+	}
+	s.Simulate(context.Background(), 20, Parameters{
+		Growth: 0.01,
+		Events: 1000,
+		IncubationRate: 0.5,
+		RecoveryRate: 0.2,
+		WaningRate: 0.1,
+		DeathRates: SusceptibleInfectedDeathRates(0.01, 0.05),
+	})
+	for _, e := range s.Events() {
+		from, ok := states[e.Identity]
+		if !ok {
+			from = Susceptible
+		}
+		if from != e.From {
+			t.Fatalf("event %+v: agent was %v", e, from)
+		}
+		states[e.Identity] = e.To
+	}
+	for _, a := range s.Agents() {
+		want, ok := states[a.Identity()]
+		if !ok {
+			want = Susceptible
+		}
+		if a.State() != want {
+			t.Fatalf("agent %d is %v, the event log gives %v",
+				a.Identity(), a.State(), want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package abm
+
+import (
+	"math"
+)
+
+// Returns true if the agent is in one of the states, or if no states
+// are given.
+func inStates(a *Agent, states []State) bool {
+	if len(states) == 0 {
+		return true
+	}
+	for _, st := range states {
+		if a.state == st {
+			return true
+		}
+	}
+	return false
+}
+
+// Counts the agents in the given states, or all agents, by age in
+// buckets of bucket_size years, keyed by bucket as for Histogram.
+func (s *Simulation) AgeHistogram(bucket_size int,
+	states ...State) map[int]int {
+	return s.Histogram(func(a *Agent) float64 { return float64(a.age) },
+		float64(bucket_size), states...)
+}
+
+// Counts the agents in the given states, or all agents, by value in
+// buckets of bucket_size. The key of a bucket is its index, so bucket k
+// holds the values from k * bucket_size up to (k + 1) * bucket_size.
+func (s *Simulation) Histogram(value func(a *Agent) float64,
+	bucket_size float64, states ...State) map[int]int {
+	counts := make(map[int]int)
+	if bucket_size <= 0.0 {
+		return counts
+	}
+	for i := range s.agents {
+		if inStates(&s.agents[i], states) {
+			v := value(&s.agents[i])
+			counts[int(math.Floor(v / bucket_size))]++
+		}
+	}
+	return counts
+}
+
+// Counts the agents in the given states, or all agents if no states are
+// given, by infectiousness, in the same way as Histogram.
+func (s *Simulation) InfectiousnessHistogram(bucket_size float64,
+	states ...State) map[int]int {
+	return s.Histogram((*Agent).Infectiousness, bucket_size, states...)
+}
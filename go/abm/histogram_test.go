@@ -0,0 +1,39 @@
+package abm
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestHistogramsKeyBucketsByIndex(t *testing.T) {
+	ages := []int{0, 4, 5, 12, 14, 30}
+	infectiousness := []float64{0.0, 0.2, 0.25, 0.6, 0.74, 1.5}
+	agents := make([]Agent, len(ages))
+	for i := range agents {
+		agents[i] = NewAgent(i, Susceptible)
+		agents[i].age = ages[i]
+		agents[i].infectiousness = infectiousness[i]
+	}
+	agents[5].state = Infected
+	s := NewSimulationFromAgents(0, agents, WithSeed(1))
+	cases := []struct {
+		name string
+		got, want map[int]int
+	}{
+		{"AgeHistogram", s.AgeHistogram(5),
+			map[int]int{0: 2, 1: 1, 2: 2, 6: 1}},
+		{"AgeHistogram of the infected", s.AgeHistogram(5, Infected),
+			map[int]int{6: 1}},
+		{"InfectiousnessHistogram", s.InfectiousnessHistogram(0.25),
+			map[int]int{0: 2, 1: 1, 2: 2, 6: 1}},
+		{"Histogram", s.Histogram(func(a *Agent) float64 {
+			return float64(a.age)
+		}, 10), map[int]int{0: 3, 1: 2, 3: 1}},
+		{"empty bucket size", s.AgeHistogram(0), map[int]int{}},
+	}
+	for _, c := range cases {
+		if !maps.Equal(c.got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
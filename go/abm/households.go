@@ -0,0 +1,87 @@
+package abm
+
+import "math"
+
+// Draws the size of a household.
+type HouseholdSizes func(rng RandSource) int
+
+// Groups the initial agents into random households whose sizes are
+// drawn from sizes.
+func WithHouseholds(sizes HouseholdSizes) Option {
+	return func(s *Simulation) {
+		s.household_sizes = sizes
+	}
+}
+
+// Returns a distribution of household sizes uniform over min to max
+// inclusive.
+func UniformHouseholdSizes(min int, max int) HouseholdSizes {
+	return func(rng RandSource) int {
+		return min + rng.Intn(max - min + 1)
+	}
+}
+
+// Returns the agent's household
+func(a *Agent) Household() int {
+    return a.household
+}
+
+// Returns the indices of the members of each household, living and
+// dead, indexed by household.
+func (s *Simulation) Households() [][]int {
+	return s.households
+}
+
+// Groups the agents into households, in order, if household sizes have
+// been set.
+func (s *Simulation) assignHouseholds() {
+	s.households = s.households[:0]
+	if s.household_sizes == nil {
+		return
+	}
+	for i := 0; i < len(s.agents); {
+		size := max(s.household_sizes(s.random()), 1)
+		members := make([]int, 0, size)
+		for ; i < len(s.agents) && len(members) < size; i++ {
+			s.agents[i].household = len(s.households)
+			members = append(members, i)
+		}
+		s.households = append(s.households, members)
+	}
+}
+
+// Puts the new agent at index i in the household of a randomly chosen
+// existing agent.
+func (s *Simulation) joinHousehold(i int) {
+	if s.household_sizes == nil {
+		return
+	}
+	if i == 0 {
+		s.households = append(s.households, nil)
+	} else {
+		s.agents[i].household = s.agents[s.random().Intn(i)].household
+	}
+	h := s.agents[i].household
+	s.households[h] = append(s.households[h], i)
+}
+
+// Transmits the infection within households with probability
+// within_rate.
+func (s *Simulation) InfectHouseholds(within_rate float64) {
+	if len(s.households) == 0 || within_rate <= 0.0 {
+		return
+	}
+	// Exposing agents does not change the pool of infected agents.
+	for _, i := range s.pools[Infected] {
+		infector := &s.agents[i]
+		for _, j := range s.households[infector.household] {
+			target := &s.agents[j]
+			prob := within_rate * math.Min(infector.infectiousness, 1.0) *
+				s.susceptibility(target)
+			if prob > 0.0 && s.random().Float64() < prob {
+				s.recordContact(i, j)
+				s.exposeBy(j, i)
+			}
+		}
+	}
+}
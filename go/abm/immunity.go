@@ -0,0 +1,22 @@
+package abm
+
+// Turns on continuous immunity, which recovered agents get at level and
+// which then wanes at the waning rate.
+func WithImmunity(level float64) Option {
+	return func(s *Simulation) {
+		s.immunity_level = level
+	}
+}
+
+// Gives an agent who has just recovered the immunity set by
+// WithImmunity, unless its immunity is already higher.
+func (s *Simulation) boostImmunity(a *Agent) {
+	a.immunity = max(a.immunity, s.immunity_level)
+}
+
+// Decays the immunity of every agent by the given fraction.
+func (s *Simulation) decayImmunity(waning_rate float64) {
+	for i := range s.agents {
+		s.agents[i].immunity *= 1.0 - waning_rate
+	}
+}
@@ -0,0 +1,26 @@
+package abm
+
+import "testing"
+
+func TestImmunityWanes(t *testing.T) {
+	s := newTestSimulation(1000, 1000, WithImmunity(0.8))
+	s.Recover(1.0)
+	s.Wane(0.5)
+	waned := 0
+	for i := range s.Agents() {
+		a := &s.Agents()[i]
+		if a.Immunity() != 0.4 {
+			t.Fatalf("agent %d has immunity %g, want 0.4", i, a.Immunity())
+		}
+		if a.State() == Susceptible {
+			waned++
+			if sus := s.susceptibility(a); sus != 0.6 {
+				t.Fatalf("waned agent %d has susceptibility %g, want 0.6",
+					i, sus)
+			}
+		}
+	}
+	if waned == 0 {
+		t.Fatal("no agent waned")
+	}
+}
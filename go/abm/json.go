@@ -0,0 +1,80 @@
+package abm
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// The JSON representation of an agent.
+type agentJSON struct {
+	Identity int `json:"identity"`
+	State string `json:"state"`
+}
+
+// The JSON representation of a simulation. Agents is only filled in
+// when the full agent list is requested.
+type simulationJSON struct {
+	Simulation int `json:"simulation"`
+	Agents int `json:"agents"`
+	Susceptible int `json:"susceptible"`
+	Exposed int `json:"exposed"`
+	Infected int `json:"infected"`
+	Recovered int `json:"recovered"`
+	Dead int `json:"dead"`
+	Vaccinated int `json:"vaccinated"`
+	Quarantined int `json:"quarantined"`
+	CumulativeInfections int `json:"cumulative_infections"`
+	AgentList []agentJSON `json:"agent_list,omitempty"`
+}
+
+// Builds the JSON representation of the simulation's current state.
+func (s *Simulation) toJSON(include_agents bool) simulationJSON {
+	st := s.Stats(0)
+	j := simulationJSON{
+		Simulation: s.identity,
+		Agents: len(s.agents),
+		Susceptible: st.Susceptible,
+		Exposed: st.Exposed,
+		Infected: st.Infected,
+		Recovered: st.Recovered,
+		Dead: st.Dead,
+		Vaccinated: st.Vaccinated,
+		Quarantined: st.Quarantined,
+		CumulativeInfections: st.CumulativeInfections,
+	}
+	if include_agents {
+		j.AgentList = make([]agentJSON, len(s.agents))
+		for i, a := range s.agents {
+			j.AgentList[i] = agentJSON{
+				Identity: a.identity,
+				State: a.state.String(),
+			}
+		}
+	}
+	return j
+}
+
+// Encodes the simulation identity and the number of agents in each
+// state as JSON.
+func (s *Simulation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.toJSON(false))
+}
+
+// Writes simulation statistics to w as a single line of JSON, in one
+// call to w.Write.
+func (s *Simulation) ReportJSONL(w io.Writer, iteration int) error {
+	line, err := json.Marshal(s.Stats(iteration))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// Writes the simulation's current state, and optionally its agents, to
+// w as JSON.
+func (s *Simulation) ExportJSON(w io.Writer, include_agents bool) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.toJSON(include_agents))
+}
@@ -0,0 +1,53 @@
+package abm
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// Makes the simulation log its reports, and its phase timings at the
+// debug level, to logger.
+func (s *Simulation) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+	s.log_timing = logger != nil &&
+		logger.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// Logs the statistics of the given iteration at the info level, named
+// as in the JSON lines reports.
+func (s *Simulation) logReport(iteration int) {
+	if s.logger == nil {
+		return
+	}
+	st := s.Stats(iteration)
+	attrs := []slog.Attr{
+		slog.Int("simulation", st.SimulationID),
+		slog.Int("iteration", st.Iteration),
+	}
+	for _, state := range report_states {
+		attrs = append(attrs, slog.Int(strings.ToLower(state.String()),
+			st.Count(state)))
+	}
+	attrs = append(attrs,
+		slog.Int("cumulative_infections", st.CumulativeInfections),
+		slog.Float64("effective_r", st.EffectiveR))
+	s.logger.LogAttrs(context.Background(), slog.LevelInfo, "report",
+		attrs...)
+}
+
+// Logs the time spent in each phase over the iterations from first to
+// last at the debug level.
+func (s *Simulation) logPhaseTimes(first int, last int) {
+	attrs := []slog.Attr{
+		slog.Int("simulation", s.identity),
+		slog.Int("first", first),
+		slog.Int("last", last),
+	}
+	for phase, d := range s.phase_times {
+		attrs = append(attrs, slog.Duration(
+			strings.ToLower(s.phase_names[phase]), d))
+	}
+	s.logger.LogAttrs(context.Background(), slog.LevelDebug, "timing",
+		attrs...)
+}
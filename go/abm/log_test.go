@@ -0,0 +1,45 @@
+package abm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestLoggerLogsReports(t *testing.T) {
+	var buf bytes.Buffer
+	s := newTestSimulation(1000, 10)
+	s.SetOutput(io.Discard)
+	s.SetReportInterval(10)
+	s.SetLogger(slog.New(slog.NewJSONHandler(&buf,
+		&slog.HandlerOptions{Level: slog.LevelDebug})))
+	s.Simulate(context.Background(), 20, benchmarkParameters)
+	reports, timings := 0, 0
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var line struct {
+			Msg string `json:"msg"`
+			Susceptible *int `json:"susceptible"`
+		}
+		if err := dec.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		switch line.Msg {
+		case "report":
+			reports++
+			if line.Susceptible == nil {
+				t.Fatal("report has no susceptible count")
+			}
+		case "timing":
+			timings++
+		}
+	}
+	// Iterations 0 and 10, and the timings of 0, 1-10 and 11-19.
+	if reports != 2 || timings != 3 {
+		t.Fatalf("got %d reports and %d timings, want 2 and 3", reports,
+			timings)
+	}
+}
@@ -0,0 +1,59 @@
+package abm
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Collects the latest statistics of any number of simulations. It is
+// safe for concurrent use.
+type MetricsCollector struct {
+	mu sync.Mutex
+	latest map[int]Stats
+}
+
+// Totals across the simulations reporting to a MetricsCollector.
+type Metrics struct {
+	Simulations int
+	Infected int
+	Dead int
+	CumulativeInfections int
+}
+
+// Creates an empty metrics collector.
+func NewMetricsCollector() *MetricsCollector {
+	return &MetricsCollector{latest: make(map[int]Stats)}
+}
+
+// Records the latest statistics of a simulation, replacing any that
+// simulation recorded before.
+func (m *MetricsCollector) Record(st Stats) {
+	m.mu.Lock()
+	m.latest[st.SimulationID] = st
+	m.mu.Unlock()
+}
+
+// Returns the totals of the latest statistics recorded by each
+// simulation.
+func (m *MetricsCollector) Snapshot() Metrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := Metrics{Simulations: len(m.latest)}
+	for _, st := range m.latest {
+		t.Infected += st.Infected
+		t.Dead += st.Dead
+		t.CumulativeInfections += st.CumulativeInfections
+	}
+	return t
+}
+
+// Makes Simulate record the simulation's statistics in m after every
+// iteration.
+func (s *Simulation) SetMetrics(m *MetricsCollector) {
+	s.metrics = m
+}
+
+// Makes Simulate add one to counter after every iteration
+func (s *Simulation) SetIterationCounter(counter *atomic.Int64) {
+	s.iteration_counter = counter
+}
@@ -0,0 +1,76 @@
+package abm
+
+// Sets the contact network used by InfectNetwork, in which network[i]
+// lists the neighbours of agent i.
+func (s *Simulation) SetNetwork(network [][]int) {
+	s.network = network
+}
+
+// Returns the contact network set by SetNetwork.
+func (s *Simulation) Network() [][]int {
+	return s.network
+}
+
+// Like Infect but each contact is between a random agent and one of its
+// neighbours in the network.
+func (s *Simulation) InfectNetwork(events int) {
+	events = s.seasonalEvents(events)
+	if len(s.agents) == 0 {
+		return
+	}
+	for i := 0; i < events; i++ {
+		ind1 := s.random().Intn(len(s.agents))
+		if ind1 >= len(s.network) || len(s.network[ind1]) == 0 {
+			continue
+		}
+		neighbours := s.network[ind1]
+		ind2 := neighbours[s.random().Intn(len(neighbours))]
+		s.contact(ind1, ind2)
+	}
+}
+
+// Returns true if j is in the list of neighbours.
+func hasNeighbour(neighbours []int, j int) bool {
+	for _, n := range neighbours {
+		if n == j {
+			return true
+		}
+	}
+	return false
+}
+
+// Generates a Watts-Strogatz small-world network over num_agents agents
+// with mean degree k.
+func SmallWorldNetwork(num_agents int, k int, rewire float64,
+	rng RandSource) [][]int {
+	network := make([][]int, num_agents)
+	if num_agents < 2 {
+		return network
+	}
+	half := k / 2
+	if half > (num_agents - 1) / 2 {
+		half = (num_agents - 1) / 2
+	}
+	for i := 0; i < num_agents; i++ {
+		for j := 1; j <= half; j++ {
+			t := (i + j) % num_agents
+			if rng.Float64() < rewire {
+				// Give up on rewiring this edge if the agent is
+				// already connected to nearly everyone.
+				for tries := 0; tries < num_agents; tries++ {
+					c := rng.Intn(num_agents)
+					if c != i && !hasNeighbour(network[i], c) {
+						t = c
+						break
+					}
+				}
+			}
+			if t == i || hasNeighbour(network[i], t) {
+				continue
+			}
+			network[i] = append(network[i], t)
+			network[t] = append(network[t], i)
+		}
+	}
+	return network
+}
@@ -0,0 +1,107 @@
+package abm
+
+// The expected number of agents in each compartment of the deterministic
+// model.
+type ODEState struct {
+	Susceptible float64
+	Exposed float64
+	Infected float64
+	Recovered float64
+}
+
+// The number of integration steps per iteration.
+const odeSteps = 10
+
+// Returns the rates of change of the compartments in state x under the
+// rates in p and the transmission probability, for a population of size n.
+func odeDerivative(p Parameters, transmission float64, n float64,
+	x ODEState) ODEState {
+	// Each event is a contact between two random agents, which infects
+	// with the transmission probability if one of them is infected and
+	// the other susceptible.
+	beta := 2.0 * float64(p.Events) * transmission / n
+	infection := beta * x.Susceptible * x.Infected / n
+	incubation := p.IncubationRate * x.Exposed
+	recovery := p.RecoveryRate * x.Infected
+	waning := p.WaningRate * x.Recovered
+	return ODEState{
+		Susceptible: waning - infection,
+		Exposed: infection - incubation,
+		Infected: incubation - recovery,
+		Recovered: recovery - waning,
+	}
+}
+
+// Returns x + h * d.
+func (x ODEState) step(h float64, d ODEState) ODEState {
+	return ODEState{
+		Susceptible: x.Susceptible + h * d.Susceptible,
+		Exposed: x.Exposed + h * d.Exposed,
+		Infected: x.Infected + h * d.Infected,
+		Recovered: x.Recovered + h * d.Recovered,
+	}
+}
+
+// Returns the trajectory of the deterministic SEIR model with the rates
+// in p and the probability that a contact transmits, starting from
+// initial.
+func ODETrajectory(p Parameters, transmission float64, initial ODEState,
+	iterations int) []ODEState {
+	n := initial.Susceptible + initial.Exposed + initial.Infected +
+		initial.Recovered
+	trajectory := make([]ODEState, 0, iterations)
+	if n == 0.0 {
+		for range iterations {
+			trajectory = append(trajectory, initial)
+		}
+		return trajectory
+	}
+	const h = 1.0 / odeSteps
+	x := initial
+	for range iterations {
+		for range odeSteps {
+			k1 := odeDerivative(p, transmission, n, x)
+			k2 := odeDerivative(p, transmission, n, x.step(h / 2, k1))
+			k3 := odeDerivative(p, transmission, n, x.step(h / 2, k2))
+			k4 := odeDerivative(p, transmission, n, x.step(h, k3))
+			x = x.step(h / 6, k1).step(h / 3, k2).step(h / 3, k3).
+				step(h / 6, k4)
+		}
+		trajectory = append(trajectory, x)
+	}
+	return trajectory
+}
+
+// Returns the difference between the infected fraction in the history
+// and that predicted by ODETrajectory with the simulation's transmission
+// probability.
+func (s *Simulation) CompareToODE(p Parameters) []float64 {
+	if len(s.history) == 0 {
+		return nil
+	}
+	first := s.history[0]
+	initial := ODEState{
+		Susceptible: float64(first.Susceptible),
+		Exposed: float64(first.Exposed),
+		Infected: float64(first.Infected),
+		Recovered: float64(first.Recovered),
+	}
+	trajectory := ODETrajectory(p, s.transmission, initial,
+		len(s.history) - 1)
+	differences := make([]float64, len(s.history))
+	for k, st := range s.history {
+		n := st.Susceptible + st.Exposed + st.Infected + st.Recovered
+		if n == 0 {
+			continue
+		}
+		expected := initial
+		if k > 0 {
+			expected = trajectory[k - 1]
+		}
+		m := expected.Susceptible + expected.Exposed +
+			expected.Infected + expected.Recovered
+		differences[k] = float64(st.Infected) / float64(n) -
+			expected.Infected / m
+	}
+	return differences
+}
@@ -0,0 +1,39 @@
+package abm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCompareToODE(t *testing.T) {
+	p := Parameters{Events: 2000, IncubationRate: 0.5, RecoveryRate: 0.1}
+	s := newTestSimulation(20000, 200)
+	checkODE(t, &s, p)
+}
+
+func TestCompareToODEWithTransmission(t *testing.T) {
+	// Half the contacts transmit, so twice as many give the same
+	// epidemic.
+	p := Parameters{Events: 4000, IncubationRate: 0.5, RecoveryRate: 0.1}
+	s := newTestSimulation(20000, 200, WithTransmissionProbability(0.5))
+	checkODE(t, &s, p)
+}
+
+// Checks that the infected fraction stays close to the ODE's when s is
+// run with p.
+func checkODE(t *testing.T, s *Simulation, p Parameters) {
+	t.Helper()
+	s.EnableHistory()
+	s.Simulate(context.Background(), 200, p)
+	differences := s.CompareToODE(p)
+	if len(differences) != 200 {
+		t.Fatalf("got %d differences, want 200", len(differences))
+	}
+	// The peak infected fraction is about 0.09.
+	for k, d := range differences {
+		if d < -0.05 || d > 0.05 {
+			t.Fatalf("iteration %d: infected fraction is %.3f from the "+
+				"ODE's", k, d)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package abm
+
+import "math"
+
+// Returns the largest number of ill agents in the history and the
+// iteration at which it was first reached.
+func PeakInfection(h []Stats) (peak int, iteration int) {
+	for k, st := range h {
+		if ill := st.Infected + st.Quarantined; k == 0 || ill > peak {
+			peak = ill
+			iteration = st.Iteration
+		}
+	}
+	return peak, iteration
+}
+
+// Returns the total number of infections by the end of the history,
+// including the initial ones. Returns 0 for an empty history.
+func FinalSize(h []Stats) int {
+	if len(h) == 0 {
+		return 0
+	}
+	return h[len(h) - 1].CumulativeInfections
+}
+
+// Returns the doubling time of the cumulative infections over the last
+// window entries of the history.
+func DoublingTime(h []Stats, window int) float64 {
+	h = h[len(h) - min(max(window, 0), len(h)):]
+	if len(h) < 2 {
+		return math.Inf(1)
+	}
+	var sum_x, sum_y, sum_xx, sum_xy float64
+	for _, st := range h {
+		if st.CumulativeInfections <= 0 {
+			return math.Inf(1)
+		}
+		x := float64(st.Iteration)
+		y := math.Log(float64(st.CumulativeInfections))
+		sum_x += x
+		sum_y += y
+		sum_xx += x * x
+		sum_xy += x * y
+	}
+	n := float64(len(h))
+	denominator := n * sum_xx - sum_x * sum_x
+	if denominator == 0.0 {
+		return math.Inf(1)
+	}
+	rate := (n * sum_xy - sum_x * sum_y) / denominator
+	if rate <= 0.0 {
+		return math.Inf(1)
+	}
+	return math.Ln2 / rate
+}
+
+// Returns the fraction of the agents in each group, given by key, that
+// have ever been infected.
+func (s *Simulation) AttackRateBy(key func(Agent) string) map[string]float64 {
+	sizes := make(map[string]int)
+	infected := make(map[string]int)
+	for _, a := range s.agents {
+		k := key(a)
+		sizes[k]++
+		if a.infections > 0 {
+			infected[k]++
+		}
+	}
+	rates := make(map[string]float64, len(sizes))
+	for k, n := range sizes {
+		rates[k] = float64(infected[k]) / float64(n)
+	}
+	return rates
+}
+
+// Returns the entry of history h for iteration k, extending a short
+// history by its last entry.
+func historyEntry(h []Stats, k int) Stats {
+	if k < len(h) {
+		return h[k]
+	}
+	st := h[len(h) - 1]
+	st.Exposed = 0
+	st.Infected = 0
+	st.Quarantined = 0
+	st.Iteration += k - (len(h) - 1)
+	return st
+}
+
+// Statistics of a set of simulations at one iteration, such as the mean
+// or the variance of each count across them.
+type MeanStats struct {
+	Iteration int `json:"iteration"`
+	Susceptible float64 `json:"susceptible"`
+	Infected float64 `json:"infected"`
+	Dead float64 `json:"dead"`
+	Recovered float64 `json:"recovered"`
+	Exposed float64 `json:"exposed"`
+	Vaccinated float64 `json:"vaccinated"`
+	Quarantined float64 `json:"quarantined"`
+	CumulativeInfections float64 `json:"cumulative_infections"`
+	EffectiveR float64 `json:"effective_r"`
+}
+
+// Returns the counts of a history entry in the order of the MeanStats
+// fields, skipping the iteration.
+func statsValues(st Stats) [9]float64 {
+	return [9]float64{
+		float64(st.Susceptible), float64(st.Infected), float64(st.Dead),
+		float64(st.Recovered), float64(st.Exposed),
+		float64(st.Vaccinated), float64(st.Quarantined),
+		float64(st.CumulativeInfections), st.EffectiveR,
+	}
+}
+
+// Builds a MeanStats from values in the order given by statsValues.
+func meanStatsFrom(iteration int, v [9]float64) MeanStats {
+	return MeanStats{
+		Iteration: iteration,
+		Susceptible: v[0],
+		Infected: v[1],
+		Dead: v[2],
+		Recovered: v[3],
+		Exposed: v[4],
+		Vaccinated: v[5],
+		Quarantined: v[6],
+		CumulativeInfections: v[7],
+		EffectiveR: v[8],
+	}
+}
+
+// Returns the mean and the population variance of every count across
+// the histories.
+func HistoryMoments(histories [][]Stats) (mean, variance []MeanStats) {
+	longest := []Stats{}
+	var used [][]Stats
+	for _, h := range histories {
+		if len(h) > 0 {
+			used = append(used, h)
+		}
+		if len(h) > len(longest) {
+			longest = h
+		}
+	}
+	mean = make([]MeanStats, len(longest))
+	variance = make([]MeanStats, len(longest))
+	n := float64(len(used))
+	for k := range longest {
+		var sum, sum_sq [9]float64
+		for _, h := range used {
+			for j, v := range statsValues(historyEntry(h, k)) {
+				sum[j] += v
+				sum_sq[j] += v * v
+			}
+		}
+		var m, v [9]float64
+		for j := range sum {
+			m[j] = sum[j] / n
+			v[j] = max(sum_sq[j] / n - m[j] * m[j], 0)
+		}
+		mean[k] = meanStatsFrom(longest[k].Iteration, m)
+		variance[k] = meanStatsFrom(longest[k].Iteration, v)
+	}
+	return mean, variance
+}
+
+// Returns the mean trajectory of the histories
+func AverageHistories(histories [][]Stats) []Stats {
+	mean, _ := HistoryMoments(histories)
+	round := func(x float64) int {
+		return int(math.Round(x))
+	}
+	avg := make([]Stats, len(mean))
+	for k, m := range mean {
+		avg[k] = Stats{
+			Iteration: m.Iteration,
+			Susceptible: round(m.Susceptible),
+			Infected: round(m.Infected),
+			Dead: round(m.Dead),
+			Recovered: round(m.Recovered),
+			Exposed: round(m.Exposed),
+			Vaccinated: round(m.Vaccinated),
+			Quarantined: round(m.Quarantined),
+			CumulativeInfections: round(m.CumulativeInfections),
+			EffectiveR: m.EffectiveR,
+		}
+	}
+	return avg
+}
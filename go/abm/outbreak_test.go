@@ -0,0 +1,147 @@
+package abm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPeakInfectionAndFinalSize(t *testing.T) {
+	h := History{
+		{Iteration: 0, Infected: 5, CumulativeInfections: 5},
+		{Iteration: 1, Infected: 8, Quarantined: 4,
+			CumulativeInfections: 15},
+		{Iteration: 2, Infected: 12, CumulativeInfections: 20},
+		{Iteration: 3, Infected: 2, CumulativeInfections: 21},
+	}
+	if peak, iteration := PeakInfection(h); peak != 12 || iteration != 1 {
+		t.Fatalf("got peak %d at %d, want 12 at 1", peak, iteration)
+	}
+	if got := FinalSize(h); got != 21 {
+		t.Fatalf("got final size %d, want 21", got)
+	}
+	if peak, iteration := PeakInfection(nil); peak != 0 || iteration != 0 {
+		t.Fatalf("empty history gave peak %d at %d", peak, iteration)
+	}
+	if got := FinalSize(nil); got != 0 {
+		t.Fatalf("empty history gave final size %d", got)
+	}
+}
+
+func TestAttackRateBy(t *testing.T) {
+	s := newTestSimulation(1000, 10, WithAges(UniformAges(0, 99)),
+		WithClusteredInfections())
+	for range 20 {
+		s.Infect(1000)
+		s.Progress(0.5)
+		s.Recover(0.2)
+	}
+	rates := s.AttackRateBy(func(a Agent) string {
+		if a.Age() < 50 {
+			return "young"
+		}
+		return "old"
+	})
+	if len(rates) != 2 {
+		t.Fatalf("got groups %v, want young and old", rates)
+	}
+	ever := 0
+	for _, a := range s.Agents() {
+		if a.Infections() > 0 {
+			ever++
+		}
+	}
+	// Nobody has been infected twice, so every infection is a
+	// different agent.
+	if ever != s.CumulativeInfections() {
+		t.Fatalf("%d agents have been infected but there were %d "+
+			"infections", ever, s.CumulativeInfections())
+	}
+	all := s.AttackRateBy(func(a Agent) string { return "" })
+	want := float64(ever) / 1000
+	if math.Abs(all[""] - want) > 1e-12 {
+		t.Fatalf("got overall attack rate %g, want %g", all[""], want)
+	}
+	if rates["young"] <= 0 || rates["old"] <= 0 {
+		t.Fatalf("got attack rates %v, want both above 0", rates)
+	}
+}
+
+func TestDoublingTime(t *testing.T) {
+	var h History
+	for i := 0; i < 30; i++ {
+		// Doubles every 5 iterations for the last 10.
+		c := 100
+		if i >= 20 {
+			c = int(math.Round(100 * math.Pow(2, float64(i - 20) / 5)))
+		}
+		h = append(h, Stats{Iteration: i, CumulativeInfections: c})
+	}
+	if got := DoublingTime(h, 10); math.Abs(got - 5) > 0.05 {
+		t.Fatalf("got doubling time %g, want 5", got)
+	}
+	if got := DoublingTime(h[:20], 10); !math.IsInf(got, 1) {
+		t.Fatalf("flat history gave doubling time %g, want +Inf", got)
+	}
+	if got := DoublingTime(h[29:], 10); !math.IsInf(got, 1) {
+		t.Fatalf("one entry gave doubling time %g, want +Inf", got)
+	}
+	if got := DoublingTime(nil, 10); !math.IsInf(got, 1) {
+		t.Fatalf("empty history gave doubling time %g, want +Inf", got)
+	}
+}
+
+func TestAverageHistories(t *testing.T) {
+	long := History{
+		{Iteration: 0, Susceptible: 90, Infected: 10},
+		{Iteration: 1, Susceptible: 80, Infected: 14, Recovered: 6},
+		{Iteration: 2, Susceptible: 76, Infected: 8, Recovered: 16},
+	}
+	short := History{
+		{Iteration: 0, Susceptible: 90, Infected: 10},
+		{Iteration: 1, Susceptible: 86, Infected: 4, Recovered: 10},
+	}
+	avg := AverageHistories([][]Stats{long, short, nil})
+	want := []Stats{
+		{Iteration: 0, Susceptible: 90, Infected: 10},
+		{Iteration: 1, Susceptible: 83, Infected: 9, Recovered: 8},
+		{Iteration: 2, Susceptible: 81, Infected: 4, Recovered: 13},
+	}
+	if len(avg) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(avg), len(want))
+	}
+	for k := range want {
+		if avg[k] != want[k] {
+			t.Fatalf("entry %d: got %+v, want %+v", k, avg[k], want[k])
+		}
+	}
+	_, variance := HistoryMoments([][]Stats{long, short})
+	if variance[0].Infected != 0 || variance[1].Infected != 25 ||
+		variance[2].Infected != 16 {
+		t.Fatalf("got infected variances %g, %g, %g, want 0, 25, 16",
+			variance[0].Infected, variance[1].Infected,
+			variance[2].Infected)
+	}
+	if got := AverageHistories(nil); len(got) != 0 {
+		t.Fatalf("no histories gave %d entries", len(got))
+	}
+}
+
+func TestEffectiveRUnderRateModel(t *testing.T) {
+	s := newTestSimulation(1000, 10)
+	for range 20 {
+		s.InfectRate(0.5)
+		s.Progress(0.5)
+		s.Recover(0.2)
+	}
+	if r := s.EffectiveR(); r <= 0.0 {
+		t.Fatalf("got EffectiveR %v under the rate model, want > 0", r)
+	}
+	// Every infection after the first ten is credited to an infector.
+	secondary := 0
+	for _, a := range s.agents {
+		secondary += a.secondary
+	}
+	if got, want := secondary, s.CumulativeInfections() - 10; got != want {
+		t.Fatalf("credited %d infections, want %d", got, want)
+	}
+}
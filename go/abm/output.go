@@ -0,0 +1,30 @@
+package abm
+
+import (
+	"io"
+)
+
+// A writer that passes each write on to a printer goroutine as a whole
+type lineWriter chan<- []byte
+
+// Sends a copy of p to the printer goroutine.
+func (w lineWriter) Write(p []byte) (int, error) {
+	b := make([]byte, len(p))
+	copy(b, p)
+	w <- b
+	return len(p), nil
+}
+
+// Starts a goroutine that copies everything written to the returned
+// lineWriter to w until the lineWriter is closed.
+func startPrinter(w io.Writer) (lineWriter, <-chan struct{}) {
+	lines := make(chan []byte, 1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for line := range lines {
+			w.Write(line)
+		}
+	}()
+	return lines, done
+}
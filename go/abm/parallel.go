@@ -0,0 +1,65 @@
+package abm
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// Parallel version of Infect that splits the events across the given
+// number of worker goroutines and applies the infections serially.
+func (s *Simulation) InfectParallel(events int, workers int) {
+	events = s.seasonalEvents(events)
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > events {
+		workers = events
+	}
+	if workers <= 1 || len(s.agents) == 0 || s.contact_rates != nil {
+		s.infect(events)
+		return
+	}
+	seeds := make([]int64, workers)
+	for w := range seeds {
+		seeds[w] = s.random().Int63()
+	}
+	found := make([][][2]int, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		n := events / workers
+		if w < events % workers {
+			n++
+		}
+		wg.Add(1)
+		go func(w int, n int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seeds[w]))
+			for i := 0; i < n; i++ {
+				ind1 := rng.Intn(len(s.agents))
+				ind2 := rng.Intn(len(s.agents))
+				if s.infectable(&s.agents[ind1]) &&
+					s.agents[ind2].state == Infected {
+					if s.transmits(rng, &s.agents[ind2],
+						&s.agents[ind1]) {
+						found[w] = append(found[w], [2]int{ind1, ind2})
+					}
+				} else if s.infectable(&s.agents[ind2]) &&
+					s.agents[ind1].state == Infected {
+					if s.transmits(rng, &s.agents[ind1],
+						&s.agents[ind2]) {
+						found[w] = append(found[w], [2]int{ind2, ind1})
+					}
+				}
+			}
+		}(w, n)
+	}
+	wg.Wait()
+	for _, pairs := range found {
+		for _, pair := range pairs {
+			s.recordContact(pair[0], pair[1])
+			if s.infectable(&s.agents[pair[0]]) {
+				s.exposeBy(pair[0], pair[1])
+			}
+		}
+	}
+}
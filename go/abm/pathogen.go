@@ -0,0 +1,211 @@
+package abm
+
+// Sets the number of pathogens circulating in the simulation, the first
+// of which is the one held in each agent's state.
+func WithPathogens(n int) Option {
+	return func(s *Simulation) {
+		s.num_pathogens = n
+	}
+}
+
+// Sets how much recovering from one pathogen protects against the
+// others, from 0 for no protection to 1 for full protection.
+func WithCrossImmunity(cross_immunity float64) Option {
+	return func(s *Simulation) {
+		s.cross_immunity = cross_immunity
+	}
+}
+
+// Returns the number of pathogens circulating in the simulation.
+func (s *Simulation) Pathogens() int {
+	if s.num_pathogens < 1 {
+		return 1
+	}
+	return s.num_pathogens
+}
+
+// Returns the agent's state for the given pathogen. For the first
+// pathogen this is the same as State.
+func (a *Agent) PathogenState(pathogen int) State {
+	if pathogen == 0 || a.state == Dead {
+		return a.state
+	}
+	return a.strains[pathogen - 1]
+}
+
+// Returns the factor by which cross-immunity reduces the agent's
+// susceptibility to the given pathogen.
+func (s *Simulation) crossFactor(a *Agent, pathogen int) float64 {
+	if s.cross_immunity == 0.0 {
+		return 1.0
+	}
+	for k := 0; k < s.Pathogens(); k++ {
+		if k != pathogen && a.PathogenState(k) == Recovered {
+			return 1.0 - s.cross_immunity
+		}
+	}
+	return 1.0
+}
+
+// Returns the probability that the agent is infected with the given
+// pathogen by a fully infectious contact.
+func (s *Simulation) susceptibilityTo(a *Agent, pathogen int) float64 {
+	sus := 0.0
+	switch a.PathogenState(pathogen) {
+	case Susceptible:
+		sus = 1.0
+	case Recovered:
+		sus = s.reinfection_factor
+	}
+	if sus == 0.0 {
+		return 0.0
+	}
+	if pathogen == 0 {
+		sus *= 1.0 - a.immunity
+	}
+	return sus * s.crossFactor(a, pathogen)
+}
+
+// Moves the agent to the given state for a pathogen other than the
+// first, logging the change.
+func (s *Simulation) setStrain(a *Agent, pathogen int, state State) {
+	s.logEvent(a, pathogen, a.strains[pathogen - 1], state)
+	a.strains[pathogen - 1] = state
+}
+
+// Like Infect but for the given pathogen. Contacts for pathogens other
+// than the first are drawn pair by pair.
+func (s *Simulation) InfectPathogen(pathogen int, events int) {
+	if pathogen == 0 {
+		s.Infect(events)
+		return
+	}
+	if len(s.agents) == 0 {
+		return
+	}
+	events = s.seasonalEvents(events)
+	for i := 0; i < events; i++ {
+		ind1 := s.random().Intn(len(s.agents))
+		ind2 := s.random().Intn(len(s.agents))
+		s.recordContact(ind1, ind2)
+		a1 := &s.agents[ind1]
+		a2 := &s.agents[ind2]
+		if a2.PathogenState(pathogen) == Infected {
+			a1, a2 = a2, a1
+		} else if a1.PathogenState(pathogen) != Infected {
+			continue
+		}
+		// a1 is infected; a2 may be infected too, in which case its
+		// susceptibility is 0.
+		prob := s.transmission * a1.infectiousness *
+			s.susceptibilityTo(a2, pathogen)
+		if prob > 0.0 && (prob >= 1.0 || s.random().Float64() < prob) {
+			s.setStrain(a2, pathogen, Exposed)
+			s.pathogen_infections[pathogen - 1]++
+		}
+	}
+}
+
+// Like Progress but for the given pathogen.
+func (s *Simulation) ProgressPathogen(pathogen int, incubation_rate float64) {
+	if pathogen == 0 {
+		s.Progress(incubation_rate)
+		return
+	}
+	for i := range s.agents {
+		if s.agents[i].PathogenState(pathogen) == Exposed &&
+			s.random().Float64() < incubation_rate {
+			s.setStrain(&s.agents[i], pathogen, Infected)
+		}
+	}
+}
+
+// Like Recover but for the given pathogen.
+func (s *Simulation) RecoverPathogen(pathogen int, recovery_rate float64) {
+	if pathogen == 0 {
+		s.Recover(recovery_rate)
+		return
+	}
+	for i := range s.agents {
+		if s.agents[i].PathogenState(pathogen) == Infected &&
+			s.random().Float64() < recovery_rate {
+			s.setStrain(&s.agents[i], pathogen, Recovered)
+		}
+	}
+}
+
+// Infects up to n randomly chosen living agents that are susceptible to
+// the given pathogen.
+func (s *Simulation) SeedPathogen(pathogen int, n int) {
+	candidates := make([]int, 0, len(s.agents))
+	for i := range s.agents {
+		if s.agents[i].PathogenState(pathogen) == Susceptible {
+			candidates = append(candidates, i)
+		}
+	}
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	// Partial Fisher-Yates shuffle to choose n of the candidates.
+	for k := 0; k < n; k++ {
+		j := k + s.random().Intn(len(candidates) - k)
+		candidates[k], candidates[j] = candidates[j], candidates[k]
+		i := candidates[k]
+		if pathogen == 0 {
+			s.setState(i, Infected)
+			s.startIllness(&s.agents[i])
+			s.agents[i].infections++
+			s.cumulative_infections++
+		} else {
+			s.setStrain(&s.agents[i], pathogen, Infected)
+			s.pathogen_infections[pathogen - 1]++
+		}
+	}
+}
+
+// Holds the number of living agents in each state of infection with one
+// pathogen.
+type PathogenStats struct {
+	Pathogen int
+	Susceptible int
+	Exposed int
+	Infected int
+	Recovered int
+	CumulativeInfections int
+}
+
+// Counts the living agents in each state of infection with the given
+// pathogen.
+func (s *Simulation) PathogenStats(pathogen int) PathogenStats {
+	ps := PathogenStats{Pathogen: pathogen}
+	if pathogen == 0 {
+		st := s.Stats(s.iteration)
+		ps.Susceptible = st.Susceptible
+		ps.Exposed = st.Exposed
+		ps.Infected = st.Infected
+		ps.Recovered = st.Recovered
+		ps.CumulativeInfections = st.CumulativeInfections
+		return ps
+	}
+	for i := range s.agents {
+		switch s.agents[i].PathogenState(pathogen) {
+		case Susceptible:
+			ps.Susceptible++
+		case Exposed:
+			ps.Exposed++
+		case Infected:
+			ps.Infected++
+		case Recovered:
+			ps.Recovered++
+		}
+	}
+	ps.CumulativeInfections = s.pathogen_infections[pathogen - 1]
+	return ps
+}
+
+// The per-iteration rates of a pathogen other than the first.
+type PathogenParameters struct {
+	Events int
+	IncubationRate float64
+	RecoveryRate float64
+}
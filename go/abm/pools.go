@@ -0,0 +1,75 @@
+package abm
+
+import "math"
+
+// Rebuilds the pools of agent indices in each state from the agents'
+// states.
+func (s *Simulation) rebuildPools() {
+	if s.pools == nil {
+		s.pools = make([][]int, len(report_states))
+	}
+	for st := range s.pools {
+		s.pools[st] = s.pools[st][:0]
+	}
+	s.pool_pos = s.pool_pos[:0]
+	for i := range s.agents {
+		s.pool_pos = append(s.pool_pos, 0)
+		s.addToPool(i)
+	}
+}
+
+// Adds agent i to the pool of its state.
+func (s *Simulation) addToPool(i int) {
+	st := s.agents[i].state
+	for i >= len(s.pool_pos) {
+		s.pool_pos = append(s.pool_pos, 0)
+	}
+	s.pool_pos[i] = len(s.pools[st])
+	s.pools[st] = append(s.pools[st], i)
+}
+
+// Removes agent i from the pool of its state by moving the last agent
+// in the pool into its place.
+func (s *Simulation) removeFromPool(i int) {
+	st := s.agents[i].state
+	pool := s.pools[st]
+	last := pool[len(pool) - 1]
+	pool[s.pool_pos[i]] = last
+	s.pool_pos[last] = s.pool_pos[i]
+	s.pools[st] = pool[:len(pool) - 1]
+}
+
+// Moves agent i to the given state, keeping the pools and the event log
+// up to date.
+func (s *Simulation) setState(i int, state State) {
+	s.logEvent(&s.agents[i], 0, s.agents[i].state, state)
+	s.removeFromPool(i)
+	s.agents[i].state = state
+	s.addToPool(i)
+	if state == Dead {
+		s.bury(i)
+	}
+}
+
+// Clears the attributes that only living agents have from dead agent i,
+// which no longer makes contacts.
+func (s *Simulation) bury(i int) {
+	a := &s.agents[i]
+	a.death_time = 0.0
+	a.has_death_time = false
+	a.contacts = nil
+	a.next_contact = 0
+	a.immunity = 0.0
+	if i < s.contact_weights.len() {
+		s.contact_weights.set(i, 0.0)
+	}
+}
+
+// Returns the number of failures before the first success in a sequence
+// of trials that each succeed with probability p.
+func geometric(rng RandSource, p float64) float64 {
+	if p >= 1.0 {
+		return 0.0
+	}
+	return math.Floor(math.Log(1.0 - rng.Float64()) / math.Log1p(-p))
+}
@@ -0,0 +1,79 @@
+package abm
+
+import (
+	"context"
+	"testing"
+)
+
+// Checks that every agent is in the pool of its state, at the position
+// recorded for it, and that the pools hold no other agents.
+func checkPools(t *testing.T, s *Simulation, step string) {
+	t.Helper()
+	total := 0
+	for st, pool := range s.pools {
+		for k, i := range pool {
+			if s.agents[i].state != State(st) {
+				t.Fatalf("after %s agent %d is %v but in the %v pool",
+					step, i, s.agents[i].state, State(st))
+			}
+			if s.pool_pos[i] != k {
+				t.Fatalf("after %s agent %d is at %d in its pool, "+
+					"recorded as %d", step, i, k, s.pool_pos[i])
+			}
+		}
+		total += len(pool)
+	}
+	if total != len(s.agents) {
+		t.Fatalf("after %s the pools hold %d agents, want %d", step,
+			total, len(s.agents))
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("after %s: %v", step, err)
+	}
+}
+
+func TestPoolsMatchStates(t *testing.T) {
+	s := newTestSimulation(1000, 100)
+	s.SetReinfection(true)
+	steps := []struct {
+		name string
+		f func()
+	}{
+		{"Infect", func() { s.Infect(1000) }},
+		{"InfectParallel", func() { s.InfectParallel(1000, 4) }},
+		{"InfectRate", func() { s.InfectRate(0.3) }},
+		{"Progress", func() { s.Progress(0.5) }},
+		{"Quarantine", func() { s.Quarantine(0.3) }},
+		{"Recover", func() { s.Recover(0.2) }},
+		{"RecoverAfter", func() { s.RecoverAfter(5) }},
+		{"Wane", func() { s.Wane(0.1) }},
+		{"Vaccinate", func() { s.Vaccinate(0.01) }},
+		{"Grow", func() { s.Grow(0.01) }},
+		{"Die", func() { s.Die(StateDeathRate(0.01, 0.05)) }},
+		{"DieExpected", func() { s.DieExpected(0.01, 0.05) }},
+	}
+	checkPools(t, &s, "NewSimulation")
+	for i := 0; i < 20; i++ {
+		s.iteration = i
+		for _, step := range steps {
+			step.f()
+			checkPools(t, &s, step.name)
+		}
+	}
+	s.Reset(500, 50)
+	checkPools(t, &s, "Reset")
+}
+
+func TestDeadAgentsAreCleared(t *testing.T) {
+	s := newTestSimulation(1000, 50, WithContactTracing(5), WithImmunity(0.9))
+	s.Simulate(context.Background(), 30, Parameters{
+		Events: 1000,
+		IncubationRate: 0.5,
+		RecoveryRate: 0.1,
+		DeathRates: SusceptibleInfectedDeathRates(0.01, 0.05),
+	})
+	if s.Stats(30).Dead == 0 {
+		t.Fatal("nobody died")
+	}
+	checkPools(t, &s, "Simulate")
+}
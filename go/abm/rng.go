@@ -0,0 +1,94 @@
+package abm
+
+import (
+	"math/rand"
+	randv2 "math/rand/v2"
+)
+
+// A source of random numbers for math/rand whose state can be saved and
+// restored.
+type pcgSource struct {
+	pcg *randv2.PCG
+}
+
+// The second half of the PCG seed, which is fixed so that a source is
+// determined by a single int64 seed.
+const pcgIncrement = 0x9e3779b97f4a7c15
+
+// Returns a new source seeded with seed.
+func newPCGSource(seed int64) *pcgSource {
+	return &pcgSource{randv2.NewPCG(uint64(seed), pcgIncrement)}
+}
+
+// Returns a non-negative pseudo-random 63-bit integer.
+func (p *pcgSource) Int63() int64 {
+	return int64(p.pcg.Uint64() >> 1)
+}
+
+// Returns a pseudo-random 64-bit integer.
+func (p *pcgSource) Uint64() uint64 {
+	return p.pcg.Uint64()
+}
+
+// Reseeds the source.
+func (p *pcgSource) Seed(seed int64) {
+	p.pcg.Seed(uint64(seed), pcgIncrement)
+}
+
+// Returns a seed for a clone drawn from a copy of the source, so that
+// the source is not advanced, and mixed so that the clone's numbers are
+// not the ones the source goes on to draw.
+func (p *pcgSource) cloneSeed() int64 {
+	pcg := *p.pcg
+	// The finaliser of splitmix64.
+	x := pcg.Uint64()
+	x = (x ^ x >> 30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x >> 27) * 0x94d049bb133111eb
+	return int64(x ^ x >> 31)
+}
+
+// The random numbers that a simulation and its distributions draw, as
+// a *rand.Rand draws them.
+type RandSource interface {
+	Float64() float64
+	Intn(n int) int
+	NormFloat64() float64
+	Int63() int64
+}
+
+// Makes the simulation draw all its random numbers from source, which
+// Save cannot save.
+func WithRandSource(source RandSource) Option {
+	return func(s *Simulation) {
+		s.draws = source
+	}
+}
+
+// Returns the source set by WithRandSource, if any, or else the
+// simulation's generator.
+func (s *Simulation) random() RandSource {
+	if s.draws != nil {
+		return s.draws
+	}
+	return s.rng
+}
+
+// Makes the simulation draw all its random numbers from src.
+func (s *Simulation) setSource(src *pcgSource) {
+	s.src = src
+	s.rng = rand.New(src)
+}
+
+// Returns a generator for the initial layout of the agents, seeded from
+// the simulation's generator and identity.
+func (s *Simulation) layoutRand() *rand.Rand {
+	return rand.New(&pcgSource{randv2.NewPCG(uint64(s.random().Int63()),
+		uint64(s.identity))})
+}
+
+// Seeds the simulation's random number generator with seed
+func WithSeed(seed int64) Option {
+	return func(s *Simulation) {
+		s.setSource(newPCGSource(seed))
+	}
+}
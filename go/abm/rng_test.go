@@ -0,0 +1,122 @@
+package abm
+
+import (
+	"io"
+	"math"
+	"testing"
+)
+
+// A RandSource that returns predetermined values in order.
+type scriptedSource struct {
+	t *testing.T
+	floats []float64
+	ints []int
+	normals []float64
+}
+
+func (r *scriptedSource) Float64() float64 {
+	if len(r.floats) == 0 {
+		r.t.Fatal("too many calls to Float64")
+	}
+	f := r.floats[0]
+	r.floats = r.floats[1:]
+	return f
+}
+
+func (r *scriptedSource) Intn(n int) int {
+	if len(r.ints) == 0 {
+		r.t.Fatal("too many calls to Intn")
+	}
+	i := r.ints[0]
+	r.ints = r.ints[1:]
+	if i < 0 || i >= n {
+		r.t.Fatalf("scripted Intn value %d is not in [0,%d)", i, n)
+	}
+	return i
+}
+
+func (r *scriptedSource) NormFloat64() float64 {
+	if len(r.normals) == 0 {
+		r.t.Fatal("too many calls to NormFloat64")
+	}
+	f := r.normals[0]
+	r.normals = r.normals[1:]
+	return f
+}
+
+func (r *scriptedSource) Int63() int64 {
+	if len(r.ints) == 0 {
+		r.t.Fatal("too many calls to Int63")
+	}
+	i := r.ints[0]
+	r.ints = r.ints[1:]
+	return int64(i)
+}
+
+func TestRandSourceScriptsAttributes(t *testing.T) {
+	src := &scriptedSource{t: t, ints: []int{0, 10, 20},
+		normals: []float64{0.0, 1.0, -1.0}}
+	s := NewSimulationOrdered(0, 3, 0, WithAges(UniformAges(30, 60)),
+		WithInfectiousness(LogNormal(0.0, 1.0)), WithSeed(1),
+		WithRandSource(src))
+	for i, want := range []float64{1.0, math.E, 1.0 / math.E} {
+		a := &s.agents[i]
+		if a.Age() != 30 + 10 * i || a.Infectiousness() != want {
+			t.Fatalf("agent %d has age %d and infectiousness %g, want "+
+				"%d and %g", i, a.Age(), a.Infectiousness(), 30 + 10 * i,
+				want)
+		}
+	}
+	if len(src.ints) > 0 || len(src.normals) > 0 {
+		t.Fatal("not every scripted value was drawn")
+	}
+}
+
+func TestRandSourceScriptsTransitions(t *testing.T) {
+	src := &scriptedSource{t: t}
+	s := NewSimulationOrdered(0, 4, 1, WithSeed(1), WithRandSource(src))
+	// A first draw of 0 makes the next event an infection, of the only
+	// infected agent and the last of the susceptible ones.
+	src.floats = []float64{0.0}
+	src.ints = []int{0, 2}
+	s.Infect(1)
+	want := []State{Infected, Susceptible, Susceptible, Exposed}
+	for i, st := range want {
+		if s.agents[i].state != st {
+			t.Fatalf("after Infect agent %d is %v, want %v", i,
+				s.agents[i].state, st)
+		}
+	}
+	// One draw per living agent, which dies if it is below the rate.
+	src.floats = []float64{0.6, 0.1, 0.5, 0.2}
+	s.Die(StateDeathRate(0.3, 0.3))
+	want = []State{Infected, Dead, Susceptible, Dead}
+	for i, st := range want {
+		if s.agents[i].state != st {
+			t.Fatalf("after Die agent %d is %v, want %v", i,
+				s.agents[i].state, st)
+		}
+	}
+	if len(src.floats) > 0 || len(src.ints) > 0 {
+		t.Fatal("not every scripted value was drawn")
+	}
+	checkPools(t, &s, "Die")
+	if err := s.Save(io.Discard); err == nil {
+		t.Fatal("Save succeeded with a source from WithRandSource")
+	}
+}
+
+func TestLayoutDependsOnIdentity(t *testing.T) {
+	s := NewSimulation(0, 1000, 100, WithSeed(7))
+	other := NewSimulation(1, 1000, 100, WithSeed(7))
+	same := 0
+	for i := range s.Agents() {
+		if s.Agents()[i].State() == other.Agents()[i].State() {
+			same++
+		}
+	}
+	// Independent layouts agree on about 82% of the agents.
+	if same == s.Len() {
+		t.Fatal("simulations 0 and 1 have the same initial layout")
+	}
+}
@@ -0,0 +1,230 @@
+package abm
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The version of the format written by Save.
+const saveVersion = 1
+
+// The saved form of an agent.
+type savedAgent struct {
+	Identity int
+	State State
+	Age int
+	InfectedAt int
+	X float64
+	Y float64
+	Infectiousness float64
+	Secondary int
+	Strains []State
+	Contacts []int
+	NextContact int
+	Household int
+	Immunity float64
+	ContactRate float64
+	Comorbid bool
+	Infections int
+	DeathTime float64
+	HasDeathTime bool
+}
+
+// The saved form of a simulation, which Save writes as a gob stream.
+type savedSimulation struct {
+	Version int
+	Identity int
+	Agents []savedAgent
+	ReinfectionFactor float64
+	Rand []byte
+	Format Format
+	ReportInterval int
+	CollectHistory bool
+	History History
+	Network [][]int
+	CumulativeInfections int
+	Resolved int
+	ResolvedSecondary int
+	Iteration int
+	Space float64
+	Ordered bool
+	MaxAgents int
+	Pools [][]int
+	PoolPos []int
+	NumPathogens int
+	CrossImmunity float64
+	PathogenInfections []int
+	LogEvents bool
+	Events EventLog
+	TraceMemory int
+	Detected []int
+	IterationsRun int
+	Households [][]int
+	ImmunityLevel float64
+	Precision int
+	Clustered bool
+	Transmission float64
+	ComorbidFraction float64
+	ComorbidMultiplier float64
+}
+
+// Writes the full state of the simulation to w, except for its function
+// and writer settings, so that LoadSimulation can resume it exactly.
+func (s *Simulation) Save(w io.Writer) error {
+	if s.src == nil {
+		return errors.New("save: the random number generator's state " +
+			"cannot be saved; create the simulation with WithSeed")
+	}
+	if s.draws != nil {
+		return errors.New("save: the state of the source set with " +
+			"WithRandSource cannot be saved")
+	}
+	state, err := s.src.pcg.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("save: %v", err)
+	}
+	saved := savedSimulation{
+		Version: saveVersion,
+		Identity: s.identity,
+		Agents: make([]savedAgent, len(s.agents)),
+		ReinfectionFactor: s.reinfection_factor,
+		Rand: state,
+		Format: s.format,
+		ReportInterval: s.report_interval,
+		CollectHistory: s.collect_history,
+		History: s.history,
+		Network: s.network,
+		CumulativeInfections: s.cumulative_infections,
+		Resolved: s.resolved,
+		ResolvedSecondary: s.resolved_secondary,
+		Iteration: s.iteration,
+		Space: s.space,
+		Ordered: s.ordered,
+		MaxAgents: s.max_agents,
+		Pools: s.pools,
+		PoolPos: s.pool_pos,
+		NumPathogens: s.num_pathogens,
+		CrossImmunity: s.cross_immunity,
+		PathogenInfections: s.pathogen_infections,
+		LogEvents: s.log_events,
+		Events: s.events,
+		TraceMemory: s.trace_memory,
+		Detected: s.detected,
+		IterationsRun: s.iterations_run,
+		Households: s.households,
+		ImmunityLevel: s.immunity_level,
+		Precision: s.precision,
+		Transmission: s.transmission,
+		Clustered: s.clustered,
+		ComorbidFraction: s.comorbid_fraction,
+		ComorbidMultiplier: s.comorbid_multiplier,
+	}
+	for i, a := range s.agents {
+		saved.Agents[i] = savedAgent{
+			Identity: a.identity,
+			State: a.state,
+			Age: a.age,
+			InfectedAt: a.infected_at,
+			X: a.x,
+			Y: a.y,
+			Infectiousness: a.infectiousness,
+			Secondary: a.secondary,
+			Strains: a.strains,
+			Contacts: a.contacts,
+			NextContact: a.next_contact,
+			Household: a.household,
+			Immunity: a.immunity,
+			ContactRate: a.contact_rate,
+			Comorbid: a.comorbid,
+			Infections: a.infections,
+			DeathTime: a.death_time,
+			HasDeathTime: a.has_death_time,
+		}
+	}
+	return gob.NewEncoder(w).Encode(&saved)
+}
+
+// Reads a simulation written by Save, after applying the options for
+// the settings that Save cannot save.
+func LoadSimulation(r io.Reader, options ...Option) (*Simulation,
+	error) {
+	var saved savedSimulation
+	if err := gob.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("load: %v", err)
+	}
+	if saved.Version != saveVersion {
+		return nil, fmt.Errorf("load: unsupported version %d",
+			saved.Version)
+	}
+	s := &Simulation{}
+	for _, option := range options {
+		option(s)
+	}
+	src := newPCGSource(0)
+	if err := src.pcg.UnmarshalBinary(saved.Rand); err != nil {
+		return nil, fmt.Errorf("load: %v", err)
+	}
+	s.setSource(src)
+	s.identity = saved.Identity
+	s.reinfection_factor = saved.ReinfectionFactor
+	s.format = saved.Format
+	s.report_interval = saved.ReportInterval
+	s.collect_history = saved.CollectHistory
+	s.history = saved.History
+	s.network = saved.Network
+	s.cumulative_infections = saved.CumulativeInfections
+	s.resolved = saved.Resolved
+	s.resolved_secondary = saved.ResolvedSecondary
+	s.iteration = saved.Iteration
+	s.space = saved.Space
+	s.ordered = saved.Ordered
+	s.max_agents = saved.MaxAgents
+	s.pools = saved.Pools
+	s.pool_pos = saved.PoolPos
+	s.num_pathogens = saved.NumPathogens
+	s.cross_immunity = saved.CrossImmunity
+	s.pathogen_infections = saved.PathogenInfections
+	s.log_events = saved.LogEvents
+	s.events = saved.Events
+	s.trace_memory = saved.TraceMemory
+	s.detected = saved.Detected
+	s.iterations_run = saved.IterationsRun
+	s.households = saved.Households
+	s.immunity_level = saved.ImmunityLevel
+	s.precision = saved.Precision
+	s.transmission = saved.Transmission
+	s.clustered = saved.Clustered
+	s.comorbid_fraction = saved.ComorbidFraction
+	s.comorbid_multiplier = saved.ComorbidMultiplier
+	s.agents = make([]Agent, len(saved.Agents))
+	for i, a := range saved.Agents {
+		s.agents[i] = Agent{
+			identity: a.Identity,
+			state: a.State,
+			age: a.Age,
+			infected_at: a.InfectedAt,
+			x: a.X,
+			y: a.Y,
+			infectiousness: a.Infectiousness,
+			secondary: a.Secondary,
+			strains: a.Strains,
+			contacts: a.Contacts,
+			next_contact: a.NextContact,
+			household: a.Household,
+			immunity: a.Immunity,
+			contact_rate: a.ContactRate,
+			comorbid: a.Comorbid,
+			infections: a.Infections,
+			death_time: a.DeathTime,
+			has_death_time: a.HasDeathTime,
+		}
+	}
+	// A simulation saved before it was populated has no pools, but the
+	// Infect methods expect one for every state.
+	for len(s.pools) < len(report_states) {
+		s.pools = append(s.pools, nil)
+	}
+	return s, nil
+}
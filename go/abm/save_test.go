@@ -0,0 +1,95 @@
+package abm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The fields of Simulation that Save does not write: the generator,
+// whose state is saved as Rand, settings that cannot be saved, and
+// state that is rebuilt. A new field must be saved or listed here.
+var unsaved_fields = []string{
+	"rng", "src", "draws", "ages", "metrics", "iteration_counter", "out",
+	"infectiousness", "hook", "seasonality", "household_sizes",
+	"timing_log", "logger", "log_timing", "contact_rates",
+	"contact_weights", "phase_times", "phase_names", "death_times",
+}
+
+// Returns the name of the saved field for a field of Simulation or
+// Agent, e.g. PoolPos for pool_pos.
+func savedName(field string) string {
+	var b strings.Builder
+	for _, word := range strings.Split(field, "_") {
+		if word != "" {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+// Checks that every field of the type of value is saved in the type of
+// saved, as named by savedName, unless it is one of unsaved.
+func checkSaved(t *testing.T, value any, saved any, unsaved []string) {
+	v, sv := reflect.TypeOf(value), reflect.TypeOf(saved)
+	skip := make(map[string]bool)
+	for _, name := range unsaved {
+		if _, ok := v.FieldByName(name); !ok {
+			t.Errorf("%s has no field %s to leave unsaved", v.Name(), name)
+		}
+		skip[name] = true
+	}
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Field(i).Name
+		if skip[name] {
+			continue
+		}
+		if _, ok := sv.FieldByName(savedName(name)); !ok {
+			t.Errorf("%s.%s is neither saved as %s.%s nor listed as "+
+				"unsaved", v.Name(), name, sv.Name(), savedName(name))
+		}
+	}
+}
+
+func TestSaveCoversEveryField(t *testing.T) {
+	checkSaved(t, Simulation{}, savedSimulation{}, unsaved_fields)
+	checkSaved(t, Agent{}, savedAgent{}, nil)
+}
+
+func TestSaveAndLoadResumesExactly(t *testing.T) {
+	p := Parameters{
+		Growth: 0.001,
+		Events: 500,
+		IncubationRate: 0.5,
+		RecoveryRate: 0.1,
+		WaningRate: 0.01,
+		DeathRates: SusceptibleInfectedDeathRates(0.001, 0.01),
+	}
+	s := newTestSimulation(1000, 10)
+	s.Simulate(context.Background(), 20, p)
+	var buf bytes.Buffer
+	if err := s.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSimulation(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Simulate(context.Background(), 20, p)
+	loaded.Simulate(context.Background(), 20, p)
+	if got, want := loaded.Stats(20), s.Stats(20); got != want {
+		t.Fatalf("loaded simulation ended with %+v, want %+v", got, want)
+	}
+	checkPools(t, loaded, "LoadSimulation")
+}
+
+func TestSaveRejectsUnsavableRand(t *testing.T) {
+	s := newTestSimulation(10, 1, WithRand(rand.New(rand.NewSource(42))))
+	if err := s.Save(io.Discard); err == nil {
+		t.Fatal("Save succeeded with a generator from WithRand")
+	}
+}
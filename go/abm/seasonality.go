@@ -0,0 +1,43 @@
+package abm
+
+import (
+	"math"
+)
+
+// Returns the factor by which transmission is multiplied at the given
+// iteration.
+type Seasonality func(iteration int) float64
+
+// Sets the seasonal forcing of transmission by seasonality(iteration)
+func WithSeasonality(seasonality Seasonality) Option {
+	return func(s *Simulation) {
+		s.seasonality = seasonality
+	}
+}
+
+// Returns a sinusoidal seasonality that peaks at 1 + amplitude every
+// period iterations, starting at iteration 0.
+func SinusoidalSeasonality(amplitude float64, period float64) Seasonality {
+	return func(iteration int) float64 {
+		f := 1.0 + amplitude * math.Cos(
+			2.0 * math.Pi * float64(iteration) / period)
+		return math.Max(f, 0.0)
+	}
+}
+
+// Returns the seasonality factor at the current iteration.
+func (s *Simulation) season() float64 {
+	if s.seasonality == nil {
+		return 1.0
+	}
+	return s.seasonality(s.iteration)
+}
+
+// Returns the number of contacts to simulate for the given number of
+// events after seasonal forcing.
+func (s *Simulation) seasonalEvents(events int) int {
+	if s.seasonality == nil {
+		return events
+	}
+	return int(math.Round(float64(events) * s.season()))
+}
@@ -0,0 +1,45 @@
+package abm
+
+// The agents of a simulation laid out as a struct of arrays, with the
+// attributes that the scanning loops read in contiguous slices.
+type agentColumns struct {
+	identities []int
+	states []State
+	ages []int
+}
+
+// Copies the identities, states and ages of the agents into columns
+func columnsOf(agents []Agent) agentColumns {
+	c := agentColumns{
+		identities: make([]int, len(agents)),
+		states: make([]State, len(agents)),
+		ages: make([]int, len(agents)),
+	}
+	for i := range agents {
+		c.identities[i] = agents[i].identity
+		c.states[i] = agents[i].state
+		c.ages[i] = agents[i].age
+	}
+	return c
+}
+
+// Counts the agents in the given state, as CountState does
+func (c *agentColumns) countState(state State) int {
+	n := 0
+	for _, st := range c.states {
+		if st == state {
+			n++
+		}
+	}
+	return n
+}
+
+// Kills living agents with the probability given by death_rate, as Die
+// does without comorbidities, death times or pools.
+func (c *agentColumns) die(rng RandSource, death_rate DeathRate) {
+	for i, state := range c.states {
+		if state != Dead && rng.Float64() < death_rate(c.ages[i], state) {
+			c.states[i] = Dead
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package abm
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// Kills living agents as agentColumns.die does, scanning the agents.
+func dieAgents(agents []Agent, rng RandSource, death_rate DeathRate) {
+	for i := range agents {
+		a := &agents[i]
+		if a.state != Dead && rng.Float64() < death_rate(a.age, a.state) {
+			a.state = Dead
+		}
+	}
+}
+
+func TestColumnsMatchAgents(t *testing.T) {
+	s := newTestSimulation(1000, 100, WithAges(UniformAges(0, 99)))
+	agents := s.Agents()
+	c := columnsOf(agents)
+	for _, state := range []State{Susceptible, Infected, Dead} {
+		if got, want := c.countState(state),
+			CountState(agents, state); got != want {
+			t.Fatalf("counted %d agents %v, want %d", got, state, want)
+		}
+	}
+	rate := AgeBracketDeathRate([]AgeBracket{{49, 0.01, 0.1},
+		{99, 0.1, 0.5}})
+	c.die(rand.New(rand.NewSource(1)), rate)
+	dieAgents(agents, rand.New(rand.NewSource(1)), rate)
+	if !slices.Equal(c.states, columnsOf(agents).states) {
+		t.Fatal("the layouts' deaths differ")
+	}
+}
+
+// Compares counting and killing agents in the two layouts.
+func BenchmarkLayout(b *testing.B) {
+	rate := StateDeathRate(0, 0)
+	runSizes(b, func(b *testing.B, num_agents int) {
+		s := newBenchmarkSimulation(num_agents)
+		agents := s.Agents()
+		c := columnsOf(agents)
+		rng := rand.New(rand.NewSource(1))
+		b.Run("count/agents", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				CountState(agents, Infected)
+			}
+		})
+		b.Run("count/columns", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.countState(Infected)
+			}
+		})
+		b.Run("die/agents", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dieAgents(agents, rng, rate)
+			}
+		})
+		b.Run("die/columns", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.die(rng, rate)
+			}
+		})
+	})
+}
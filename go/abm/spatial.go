@@ -0,0 +1,156 @@
+package abm
+
+import (
+	"math"
+)
+
+// Places the agents at random positions in a square of the given size,
+// which wraps around at the edges.
+func WithSpace(size float64) Option {
+	return func(s *Simulation) {
+		s.space = size
+	}
+}
+
+// Returns the agent's position.
+func (a *Agent) Position() (float64, float64) {
+	return a.x, a.y
+}
+
+// Wraps a coordinate into the interval [0, size).
+func wrap(v float64, size float64) float64 {
+	v = math.Mod(v, size)
+	if v < 0.0 {
+		v += size
+	}
+	return v
+}
+
+// Moves every living agent a distance of step in a random direction.
+func (s *Simulation) Move(step float64) {
+	if s.space <= 0.0 {
+		return
+	}
+	for i := range s.agents {
+		a := &s.agents[i]
+		if a.state == Dead {
+			continue
+		}
+		theta := 2.0 * math.Pi * s.random().Float64()
+		a.x = wrap(a.x + step * math.Cos(theta), s.space)
+		a.y = wrap(a.y + step * math.Sin(theta), s.space)
+	}
+}
+
+// Returns the distance between two points along one axis of the torus.
+func torusDelta(a float64, b float64, size float64) float64 {
+	d := math.Abs(a - b)
+	if d > size / 2.0 {
+		d = size - d
+	}
+	return d
+}
+
+// Buckets the living agents into a grid of square cells at least as
+// wide as radius.
+type grid struct {
+	side int
+	cell float64
+	start []int
+	indices []int
+}
+
+// Builds the grid of living agents for the given radius.
+func (s *Simulation) buildGrid(radius float64) grid {
+	side := int(s.space / radius)
+	// Don't use more cells than agents, and fall back to one cell if
+	// the neighbourhood of a cell would wrap onto itself.
+	max_side := int(math.Sqrt(float64(len(s.agents)))) + 1
+	if side > max_side {
+		side = max_side
+	}
+	if side < 3 {
+		side = 1
+	}
+	g := grid{side: side, cell: s.space / float64(side)}
+	g.start = make([]int, side * side + 1)
+	cells := make([]int, len(s.agents))
+	for i := range s.agents {
+		if s.agents[i].state == Dead {
+			cells[i] = -1
+			continue
+		}
+		cells[i] = g.cellOf(s.agents[i].x, s.agents[i].y)
+		g.start[cells[i] + 1]++
+	}
+	for c := 1; c < len(g.start); c++ {
+		g.start[c] += g.start[c - 1]
+	}
+	g.indices = make([]int, g.start[len(g.start) - 1])
+	next := make([]int, side * side)
+	copy(next, g.start)
+	for i, c := range cells {
+		if c >= 0 {
+			g.indices[next[c]] = i
+			next[c]++
+		}
+	}
+	return g
+}
+
+// Returns the index of the cell containing the point.
+func (g *grid) cellOf(x float64, y float64) int {
+	cx := int(x / g.cell)
+	cy := int(y / g.cell)
+	if cx >= g.side {
+		cx = g.side - 1
+	}
+	if cy >= g.side {
+		cy = g.side - 1
+	}
+	return cy * g.side + cx
+}
+
+// Like Infect but the second agent of each contact is chosen at random
+// from the living agents within radius of the first.
+func (s *Simulation) InfectSpatial(radius float64, events int) {
+	if s.space <= 0.0 || radius <= 0.0 || len(s.agents) == 0 {
+		return
+	}
+	events = s.seasonalEvents(events)
+	g := s.buildGrid(radius)
+	var nearby []int
+	for e := 0; e < events; e++ {
+		ind1 := s.random().Intn(len(s.agents))
+		a := &s.agents[ind1]
+		if a.state == Dead {
+			continue
+		}
+		nearby = nearby[:0]
+		c := g.cellOf(a.x, a.y)
+		cx, cy := c % g.side, c / g.side
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if g.side == 1 && (dx != 0 || dy != 0) {
+					continue
+				}
+				n := ((cy + dy + g.side) % g.side) * g.side +
+					(cx + dx + g.side) % g.side
+				for _, j := range g.indices[g.start[n]:g.start[n + 1]] {
+					if j == ind1 {
+						continue
+					}
+					b := &s.agents[j]
+					dist_x := torusDelta(a.x, b.x, s.space)
+					dist_y := torusDelta(a.y, b.y, s.space)
+					if dist_x * dist_x + dist_y * dist_y <= radius * radius {
+						nearby = append(nearby, j)
+					}
+				}
+			}
+		}
+		if len(nearby) > 0 {
+			s.contact(ind1, nearby[s.random().Intn(len(nearby))])
+		}
+	}
+}
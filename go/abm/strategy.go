@@ -0,0 +1,266 @@
+package abm
+
+// One of the events that make up an iteration of a simulation, such as
+// growth, infection or death.
+type EventStrategy interface {
+	// Applies the event to the simulation in the given iteration.
+	Apply(s *Simulation, iteration int)
+}
+
+// Implemented by strategies that give the name of their event in the
+// timing log. Other strategies are timed as Event.
+type NamedStrategy interface {
+	EventStrategy
+	Name() string
+}
+
+// Returns the name of the event of e in the timing log.
+func strategyName(e EventStrategy) string {
+	if n, ok := e.(NamedStrategy); ok {
+		return n.Name()
+	}
+	return "Event"
+}
+
+// Adapts a function to an EventStrategy, for events without a strategy
+// of their own.
+type EventFunc func(s *Simulation, iteration int)
+
+// Calls f.
+func (f EventFunc) Apply(s *Simulation, iteration int) {
+	f(s, iteration)
+}
+
+// Grows the population by Growth, as Grow does.
+type GrowStrategy struct {
+	Growth float64
+}
+
+func (g GrowStrategy) Apply(s *Simulation, iteration int) {
+	s.Grow(g.Growth)
+}
+
+func (g GrowStrategy) Name() string {
+	return "Grow"
+}
+
+// Vaccinates a fraction Rate of the population, as Vaccinate does.
+type VaccinateStrategy struct {
+	Rate float64
+}
+
+func (v VaccinateStrategy) Apply(s *Simulation, iteration int) {
+	s.Vaccinate(v.Rate)
+}
+
+func (v VaccinateStrategy) Name() string {
+	return "Vaccinate"
+}
+
+// Infects through Events contacts, as Infect does, or a number of
+// contacts drawn from Distribution if it is set.
+type InfectStrategy struct {
+	Events int
+	Distribution CountDistribution
+}
+
+func (f InfectStrategy) Apply(s *Simulation, iteration int) {
+	s.Infect(drawEvents(s, f.Events, f.Distribution))
+}
+
+func (f InfectStrategy) Name() string {
+	return "Infect"
+}
+
+// Returns the number of contacts for an iteration: events, or a number
+// drawn from distribution if it is set.
+func drawEvents(s *Simulation, events int,
+	distribution CountDistribution) int {
+	if distribution != nil {
+		return distribution(s.random())
+	}
+	return events
+}
+
+// Infects with mass action at TransmissionRate, as InfectRate does.
+type InfectRateStrategy struct {
+	TransmissionRate float64
+}
+
+func (f InfectRateStrategy) Apply(s *Simulation, iteration int) {
+	s.InfectRate(f.TransmissionRate)
+}
+
+func (f InfectRateStrategy) Name() string {
+	return "InfectRate"
+}
+
+// Infects through contacts along the contact network, as InfectNetwork
+// does, counted as for InfectStrategy.
+type InfectNetworkStrategy struct {
+	Events int
+	Distribution CountDistribution
+}
+
+func (f InfectNetworkStrategy) Apply(s *Simulation, iteration int) {
+	s.InfectNetwork(drawEvents(s, f.Events, f.Distribution))
+}
+
+func (f InfectNetworkStrategy) Name() string {
+	return "InfectNetwork"
+}
+
+// Moves the agents Step and then infects within Radius, as InfectSpatial
+// does.
+type InfectSpatialStrategy struct {
+	Radius float64
+	Step float64
+	Events int
+	Distribution CountDistribution
+}
+
+func (f InfectSpatialStrategy) Apply(s *Simulation, iteration int) {
+	if f.Step > 0.0 {
+		s.Move(f.Step)
+	}
+	s.InfectSpatial(f.Radius, drawEvents(s, f.Events, f.Distribution))
+}
+
+func (f InfectSpatialStrategy) Name() string {
+	return "InfectSpatial"
+}
+
+// Ends incubation with probability Rate, as Progress does.
+type ProgressStrategy struct {
+	Rate float64
+}
+
+func (p ProgressStrategy) Apply(s *Simulation, iteration int) {
+	s.Progress(p.Rate)
+}
+
+func (p ProgressStrategy) Name() string {
+	return "Progress"
+}
+
+// Recovers ill agents with probability Rate, as Recover does.
+type RecoverStrategy struct {
+	Rate float64
+}
+
+func (r RecoverStrategy) Apply(s *Simulation, iteration int) {
+	s.Recover(r.Rate)
+}
+
+func (r RecoverStrategy) Name() string {
+	return "Recover"
+}
+
+// Makes recovered agents susceptible again with probability Rate, as
+// Wane does.
+type WaneStrategy struct {
+	Rate float64
+}
+
+func (w WaneStrategy) Apply(s *Simulation, iteration int) {
+	s.Wane(w.Rate)
+}
+
+func (w WaneStrategy) Name() string {
+	return "Wane"
+}
+
+// Kills agents with the probabilities given by DeathRate, as Die does.
+type DieStrategy struct {
+	DeathRate DeathRate
+}
+
+func (d DieStrategy) Apply(s *Simulation, iteration int) {
+	s.Die(d.DeathRate)
+}
+
+func (d DieStrategy) Name() string {
+	return "Die"
+}
+
+// Infects within households at Rate, as InfectHouseholds does.
+type InfectHouseholdsStrategy struct {
+	Rate float64
+}
+
+func (f InfectHouseholdsStrategy) Apply(s *Simulation, iteration int) {
+	s.InfectHouseholds(f.Rate)
+}
+
+func (f InfectHouseholdsStrategy) Name() string {
+	return "InfectHouseholds"
+}
+
+// Quarantines detected agents, as Quarantine does, and traces their
+// contacts with TraceProbability if contacts are being remembered.
+type QuarantineStrategy struct {
+	DetectionRate float64
+	TraceProbability float64
+}
+
+func (q QuarantineStrategy) Apply(s *Simulation, iteration int) {
+	s.Quarantine(q.DetectionRate)
+	if s.trace_memory > 0 {
+		s.TraceAndQuarantine(q.TraceProbability)
+	}
+}
+
+func (q QuarantineStrategy) Name() string {
+	return "Quarantine"
+}
+
+// Infects, progresses and recovers the agents of each pathogen after the
+// first with its Pathogens entry.
+type PathogensStrategy struct {
+	Pathogens []PathogenParameters
+}
+
+func (f PathogensStrategy) Apply(s *Simulation, iteration int) {
+	for k, pp := range f.Pathogens {
+		if k + 1 >= s.Pathogens() {
+			break
+		}
+		s.InfectPathogen(k + 1, pp.Events)
+		s.ProgressPathogen(k + 1, pp.IncubationRate)
+		s.RecoverPathogen(k + 1, pp.RecoveryRate)
+	}
+}
+
+func (f PathogensStrategy) Name() string {
+	return "Pathogens"
+}
+
+// Returns the strategies for the events that Simulate runs with p when
+// p.Strategies is not set.
+func DefaultStrategies(p Parameters) []EventStrategy {
+	return defaultStrategies(p, StateMapDeathRate(p.DeathRates))
+}
+
+// Returns DefaultStrategies(p), killing agents with death_rate if
+// p.DeathRate is not set.
+func defaultStrategies(p Parameters, death_rate DeathRate) []EventStrategy {
+	if p.DeathRate != nil {
+		death_rate = p.DeathRate
+	}
+	if p.BackgroundDeathRate > 0.0 {
+		death_rate = AddBackgroundDeathRate(death_rate,
+			p.BackgroundDeathRate)
+	}
+	return []EventStrategy{
+		GrowStrategy{p.Growth},
+		VaccinateStrategy{p.VaccinationRate},
+		InfectStrategy{p.Events, p.EventsDistribution},
+		InfectHouseholdsStrategy{p.HouseholdRate},
+		ProgressStrategy{p.IncubationRate},
+		QuarantineStrategy{p.DetectionRate, p.TraceProbability},
+		RecoverStrategy{p.RecoveryRate},
+		PathogensStrategy{p.Pathogens},
+		WaneStrategy{p.WaningRate},
+		DieStrategy{death_rate},
+	}
+}
@@ -0,0 +1,94 @@
+package abm
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDefaultStrategiesMatchSimulate(t *testing.T) {
+	p := Parameters{
+		Growth: 0.001,
+		Events: 500,
+		EventsDistribution: PoissonEvents(500),
+		VaccinationRate: 0.001,
+		IncubationRate: 0.5,
+		DetectionRate: 0.05,
+		RecoveryRate: 0.1,
+		WaningRate: 0.01,
+		DeathRates: SusceptibleInfectedDeathRates(0.001, 0.01),
+	}
+	s := newTestSimulation(1000, 10)
+	s.Simulate(context.Background(), 50, p)
+	p.Strategies = DefaultStrategies(p)
+	strategies := newTestSimulation(1000, 10)
+	strategies.Simulate(context.Background(), 50, p)
+	if got, want := strategies.Stats(50), s.Stats(50); got != want {
+		t.Fatalf("strategies ended with %+v, want %+v", got, want)
+	}
+}
+
+func TestInfectionStrategiesMatchMethods(t *testing.T) {
+	network := SmallWorldNetwork(1000, 6, 0.1, rand.New(rand.NewSource(1)))
+	cases := []struct {
+		name string
+		strategy EventStrategy
+		infect func(s *Simulation)
+	}{
+		{"rate", InfectRateStrategy{TransmissionRate: 0.5},
+			func(s *Simulation) { s.InfectRate(0.5) }},
+		{"network", InfectNetworkStrategy{Events: 500},
+			func(s *Simulation) { s.InfectNetwork(500) }},
+		{"spatial", InfectSpatialStrategy{Radius: 5, Events: 500},
+			func(s *Simulation) { s.InfectSpatial(5, 500) }},
+		{"poisson network", InfectNetworkStrategy{
+			Distribution: PoissonEvents(500)},
+			func(s *Simulation) {
+				s.InfectNetwork(PoissonEvents(500)(s.rng))
+			}},
+		{"moving spatial", InfectSpatialStrategy{Radius: 5, Step: 2,
+			Events: 500},
+			func(s *Simulation) {
+				s.Move(2)
+				s.InfectSpatial(5, 500)
+			}},
+	}
+	for _, c := range cases {
+		s := newTestSimulation(1000, 50, WithSpace(100))
+		s.SetNetwork(network)
+		c.infect(&s)
+		w := newTestSimulation(1000, 50, WithSpace(100))
+		w.SetNetwork(network)
+		c.strategy.Apply(&w, 0)
+		if got, want := w.Stats(0), s.Stats(0); got != want {
+			t.Fatalf("%s: strategy gave %+v, want %+v", c.name, got, want)
+		}
+		if s.Stats(0).Exposed == 0 {
+			t.Fatalf("%s: nobody was infected", c.name)
+		}
+	}
+}
+
+func TestStrategiesAreTimed(t *testing.T) {
+	p := Parameters{Strategies: []EventStrategy{
+		InfectRateStrategy{TransmissionRate: 0.5},
+		RecoverStrategy{Rate: 0.1},
+		EventFunc(func(s *Simulation, iteration int) {}),
+	}}
+	s := newTestSimulation(1000, 10)
+	var timing bytes.Buffer
+	s.SetTimingLog(&timing)
+	s.Simulate(context.Background(), 5, p)
+	names := []string{" InfectRate: ", " Recover: ", " Event: "}
+	for _, name := range names {
+		if !strings.Contains(timing.String(), name) {
+			t.Fatalf("timing log %q does not time%s", timing.String(),
+				strings.TrimSuffix(name, ": "))
+		}
+	}
+	if strings.Contains(timing.String(), " InfectRate: 0s") {
+		t.Fatalf("InfectRate was not timed: %q", timing.String())
+	}
+}
@@ -0,0 +1,64 @@
+package abm
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Makes Simulate write the wall time spent in each phase of an
+// iteration to w every reporting interval.
+func (s *Simulation) SetTimingLog(w io.Writer) {
+	s.timing_log = w
+}
+
+// Returns true if the phases are being timed, for the timing log or the
+// logger set by SetLogger.
+func (s *Simulation) timing() bool {
+	return s.timing_log != nil || s.log_timing
+}
+
+// Applies the strategies in the given iteration, adding the time spent
+// in each to its phase if timing is on.
+func (s *Simulation) apply(strategies []EventStrategy, iteration int) {
+	if !s.timing() {
+		for _, e := range strategies {
+			e.Apply(s, iteration)
+		}
+		return
+	}
+	if len(s.phase_times) != len(strategies) {
+		s.phase_times = make([]time.Duration, len(strategies))
+		s.phase_names = make([]string, len(strategies))
+	}
+	start := time.Now()
+	for k, e := range strategies {
+		e.Apply(s, iteration)
+		now := time.Now()
+		s.phase_times[k] += now.Sub(start)
+		s.phase_names[k] = strategyName(e)
+		start = now
+	}
+}
+
+// Writes and logs the time spent in each phase over the iterations from
+// first to last, and starts the totals again.
+func (s *Simulation) logTiming(first int, last int) {
+	if !s.timing() {
+		return
+	}
+	if s.log_timing {
+		s.logPhaseTimes(first, last)
+	}
+	if s.timing_log == nil {
+		clear(s.phase_times)
+		return
+	}
+	line := fmt.Sprintf("Simulation: %d Iterations: %d-%d", s.identity,
+		first, last)
+	for phase, d := range s.phase_times {
+		line += fmt.Sprintf(" %s: %v", s.phase_names[phase], d)
+	}
+	io.WriteString(s.timing_log, line + "\n")
+	clear(s.phase_times)
+}
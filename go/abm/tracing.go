@@ -0,0 +1,49 @@
+package abm
+
+// Turns on contact tracing, remembering up to memory of each agent's
+// most recent contacts.
+func WithContactTracing(memory int) Option {
+	return func(s *Simulation) {
+		s.trace_memory = memory
+	}
+}
+
+// Remembers that the agents at indices ind1 and ind2 were in contact
+func (s *Simulation) recordContact(ind1 int, ind2 int) {
+	if s.trace_memory <= 0 || ind1 == ind2 {
+		return
+	}
+	s.agents[ind1].remember(ind2, s.trace_memory)
+	s.agents[ind2].remember(ind1, s.trace_memory)
+}
+
+// Adds the agent at index i to the agent's recent contacts, replacing
+// the oldest once there are memory of them.
+func (a *Agent) remember(i int, memory int) {
+	if len(a.contacts) < memory {
+		a.contacts = append(a.contacts, i)
+		return
+	}
+	a.contacts[a.next_contact] = i
+	a.next_contact = (a.next_contact + 1) % memory
+}
+
+// Quarantines, with probability trace_prob each, the exposed and
+// infected recent contacts of the agents quarantined since the last call.
+func (s *Simulation) TraceAndQuarantine(trace_prob float64) {
+	for _, i := range s.detected {
+		for _, c := range s.agents[i].contacts {
+			state := s.agents[c].state
+			if state != Exposed && state != Infected {
+				continue
+			}
+			if s.random().Float64() < trace_prob {
+				if state == Exposed {
+					s.startIllness(&s.agents[c])
+				}
+				s.setState(c, Quarantined)
+			}
+		}
+	}
+	s.detected = s.detected[:0]
+}
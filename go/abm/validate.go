@@ -0,0 +1,98 @@
+package abm
+
+import "fmt"
+
+// Checks the invariants that every change to the simulation should
+// keep, returning an error describing the first that does not hold.
+func (s *Simulation) Validate() error {
+	if len(s.pool_pos) != len(s.agents) {
+		return fmt.Errorf("%d agents but %d pool positions",
+			len(s.agents), len(s.pool_pos))
+	}
+	if len(s.agents) > 0 && len(s.pools) != len(report_states) {
+		return fmt.Errorf("%d pools for %d states", len(s.pools),
+			len(report_states))
+	}
+	seen := make(map[int]int, len(s.agents))
+	for i := range s.agents {
+		a := &s.agents[i]
+		if !known(a.state) {
+			return fmt.Errorf("agent %d is in unknown state %d", i,
+				int(a.state))
+		}
+		pool := s.pools[a.state]
+		if k := s.pool_pos[i]; k < 0 || k >= len(pool) || pool[k] != i {
+			return fmt.Errorf("agent %d is not at position %d of the %v "+
+				"pool", i, k, a.state)
+		}
+		if j, ok := seen[a.identity]; ok {
+			return fmt.Errorf("agents %d and %d both have identity %d",
+				j, i, a.identity)
+		}
+		seen[a.identity] = i
+		if err := s.validateAgent(i); err != nil {
+			return err
+		}
+	}
+	total := 0
+	for _, pool := range s.pools {
+		total += len(pool)
+	}
+	if total != len(s.agents) {
+		return fmt.Errorf("the pools hold %d agents, not %d", total,
+			len(s.agents))
+	}
+	current := s.count(Exposed) + s.count(Infected) + s.count(Quarantined)
+	if current > s.cumulative_infections {
+		return fmt.Errorf("%d agents are infected but only %d "+
+			"infections are recorded", current, s.cumulative_infections)
+	}
+	return nil
+}
+
+// Checks the attributes of the agent at index i other than its state.
+func (s *Simulation) validateAgent(i int) error {
+	a := &s.agents[i]
+	if s.Pathogens() > 1 {
+		if len(a.strains) != s.Pathogens() - 1 {
+			return fmt.Errorf("agent %d has states for %d pathogens, "+
+				"not %d", i, len(a.strains) + 1, s.Pathogens())
+		}
+		for k, st := range a.strains {
+			switch st {
+			case Susceptible, Exposed, Infected, Recovered:
+			default:
+				return fmt.Errorf("agent %d is %v for pathogen %d", i,
+					st, k + 1)
+			}
+		}
+	}
+	if a.state == Dead &&
+		(a.has_death_time || len(a.contacts) > 0 || a.immunity != 0.0) {
+		return fmt.Errorf("agent %d is dead but keeps a pending death "+
+			"time (%v), %d contacts and immunity %g", i, a.has_death_time,
+			len(a.contacts), a.immunity)
+	}
+	if a.immunity < 0.0 || a.immunity > 1.0 {
+		return fmt.Errorf("agent %d has immunity %g", i, a.immunity)
+	}
+	if a.infectiousness < 0.0 || a.contact_rate < 0.0 {
+		return fmt.Errorf("agent %d has infectiousness %g and contact "+
+			"rate %g", i, a.infectiousness, a.contact_rate)
+	}
+	if len(s.households) > 0 {
+		h := a.household
+		if h < 0 || h >= len(s.households) {
+			return fmt.Errorf("agent %d is in unknown household %d", i, h)
+		}
+		found := false
+		for _, j := range s.households[h] {
+			found = found || j == i
+		}
+		if !found {
+			return fmt.Errorf("agent %d is not a member of its "+
+				"household %d", i, h)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package abm
+
+import "testing"
+
+func TestValidateFindsBrokenInvariants(t *testing.T) {
+	cases := []struct {
+		name string
+		breakIt func(s *Simulation)
+	}{
+		{"unknown state", func(s *Simulation) { s.agents[0].state = 42 }},
+		{"unrecorded state", func(s *Simulation) {
+			s.agents[0].state = Recovered
+		}},
+		{"duplicate identity", func(s *Simulation) {
+			s.agents[1].identity = s.agents[0].identity
+		}},
+		{"immunity", func(s *Simulation) { s.agents[2].immunity = 2 }},
+		{"infections", func(s *Simulation) {
+			s.cumulative_infections = 0
+		}},
+		{"dead with contacts", func(s *Simulation) {
+			s.setState(3, Dead)
+			s.agents[3].contacts = []int{4}
+		}},
+		{"dead with death time", func(s *Simulation) {
+			s.setState(3, Dead)
+			s.agents[3].has_death_time = true
+		}},
+	}
+	for _, c := range cases {
+		s := newTestSimulation(100, 10)
+		if err := s.Validate(); err != nil {
+			t.Fatalf("%s: new simulation is invalid: %v", c.name, err)
+		}
+		c.breakIt(&s)
+		if err := s.Validate(); err == nil {
+			t.Fatalf("%s: Validate found nothing wrong", c.name)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package abm
+
+import "math/bits"
+
+// A Fenwick tree of non-negative weights for drawing indices with
+// probability proportional to them, in which a weight can be changed or
+// an index added in O(log n) time.
+type weightTree struct {
+	// sums[k - 1] is the sum of the weights of the indices from
+	// k - (k & -k) to k - 1.
+	sums []float64
+	weights []float64
+	total float64
+}
+
+// Returns the number of indices in the tree.
+func (t *weightTree) len() int {
+	return len(t.weights)
+}
+
+// Adds an index with weight w.
+func (t *weightTree) push(w float64) {
+	k := len(t.sums) + 1
+	sum := w
+	for j := 1; j < k & -k; j *= 2 {
+		sum += t.sums[k - j - 1]
+	}
+	t.sums = append(t.sums, sum)
+	t.weights = append(t.weights, w)
+	t.total += w
+}
+
+// Sets the weight of index i to w.
+func (t *weightTree) set(i int, w float64) {
+	d := w - t.weights[i]
+	t.weights[i] = w
+	t.total += d
+	for k := i + 1; k <= len(t.sums); k += k & -k {
+		t.sums[k - 1] += d
+	}
+}
+
+// Draws an index. The total weight must be positive.
+func (t *weightTree) draw(rng RandSource) int {
+	n := len(t.sums)
+	u := rng.Float64() * t.total
+	// Find the most indices whose weights sum to no more than u.
+	k := 0
+	for step := 1 << (bits.Len(uint(n)) - 1); step > 0; step /= 2 {
+		if k + step <= n && t.sums[k + step - 1] <= u {
+			k += step
+			u -= t.sums[k - 1]
+		}
+	}
+	// Rounding can leave u just short of the total.
+	return min(k, n - 1)
+}
+
+// Returns a copy of the tree that can be changed independently.
+func (t *weightTree) clone() weightTree {
+	return weightTree{append([]float64(nil), t.sums...),
+		append([]float64(nil), t.weights...), t.total}
+}
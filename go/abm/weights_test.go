@@ -0,0 +1,31 @@
+package abm
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestWeightTreeMatchesWeights(t *testing.T) {
+	var tree weightTree
+	for _, w := range []float64{5, 0, 3, 2, 7} {
+		tree.push(w)
+	}
+	// Changing weights leaves 1, 0, 3, 6, 0.
+	tree.set(0, 1)
+	tree.set(3, 6)
+	tree.set(4, 0)
+	weights := []float64{1, 0, 3, 6, 0}
+	rng := rand.New(rand.NewSource(1))
+	counts := make([]int, len(weights))
+	const draws = 100000
+	for range draws {
+		counts[tree.draw(rng)]++
+	}
+	for i, w := range weights {
+		want := w / 10 * draws
+		if d := float64(counts[i]) - want; d < -1000 || d > 1000 {
+			t.Fatalf("index %d drawn %d times, want about %g", i,
+				counts[i], want)
+		}
+	}
+}
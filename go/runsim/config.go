@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Reads parameters from a JSON file keyed by the names of the command
+// line flags.
+func loadConfig(path string) (parameters, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return parameters{}, err
+	}
+	return decodeConfig(path, bytes.NewReader(data))
+}
+
+// Reads parameters in the format of a config file from r. The name is
+// used in error messages.
+func decodeConfig(path string, r io.Reader) (parameters, error) {
+	var p parameters
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	defineFlags(fs, &p)
+	var values map[string]interface{}
+	dec := json.NewDecoder(r)
+	// Keep numbers as written so that integers are not turned into
+	// floats, which the integer flags would reject.
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return p, fmt.Errorf("%s: %v", path, err)
+	}
+	p.given = make(map[string]bool)
+	for name, value := range values {
+		p.given[name] = true
+		if fs.Lookup(name) == nil {
+			return p, fmt.Errorf("%s: unknown parameter %q", path, name)
+		}
+		if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+			return p, fmt.Errorf("%s: parameter %q: %v", path, name, err)
+		}
+	}
+	p.seeded = p.given["seed"]
+	return p, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math/rand"
+	"nathangeffen/abm"
+)
+
+// The infection algorithms that -infection_model selects from.
+var infection_models = []string{"events", "rate", "network", "spatial"}
+
+// Returns the strategies that run an iteration with the infection
+// algorithm chosen by -infection_model.
+func infectionStrategies(p *parameters,
+	params abm.Parameters) []abm.EventStrategy {
+	var infect abm.EventStrategy
+	switch p.infection_model {
+	case "rate":
+		infect = abm.InfectRateStrategy{TransmissionRate: p.transmission_rate}
+	case "network":
+		infect = networkStrategy{abm.InfectNetworkStrategy{
+			Events: params.Events,
+			Distribution: params.EventsDistribution}, p}
+	case "spatial":
+		infect = abm.InfectSpatialStrategy{Radius: p.contact_radius,
+			Step: p.move_step, Events: params.Events,
+			Distribution: params.EventsDistribution}
+	default:
+		return nil
+	}
+	strategies := abm.DefaultStrategies(params)
+	for k, e := range strategies {
+		if _, ok := e.(abm.InfectStrategy); ok {
+			strategies[k] = infect
+		}
+	}
+	return strategies
+}
+
+// Infects along a small world network that it builds for each simulation
+// the first time it runs.
+type networkStrategy struct {
+	abm.InfectNetworkStrategy
+	p *parameters
+}
+
+func (n networkStrategy) Apply(s *abm.Simulation, iteration int) {
+	// Built once the agents exist, from a seed that depends on the
+	// simulation so that the batch stays reproducible.
+	if s.Network() == nil {
+		rng := rand.New(rand.NewSource(n.p.seed + int64(s.Identity())))
+		s.SetNetwork(abm.SmallWorldNetwork(s.Len(), n.p.network_degree,
+			n.p.network_rewire, rng))
+	}
+	n.InfectNetworkStrategy.Apply(s, iteration)
+}
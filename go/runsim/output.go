@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The longest that written reports stay in an output buffer, so that
+// they can be followed while a long batch runs.
+const flush_interval = time.Second
+
+// A buffered writer that a goroutine flushes every flush_interval until
+// it is closed.
+type bufferedOutput struct {
+	// Guards the buffer and err, as the flushes run alongside the
+	// writes.
+	mu sync.Mutex
+	w *bufio.Writer
+	closer func() error
+	// The first error of a flush by the goroutine, returned by the next
+	// write or Close.
+	err error
+	done chan struct{}
+	stopped chan struct{}
+}
+
+// Buffers writes to w in a buffer of size bytes, or not at all if size
+// is not positive.
+func newBufferedOutput(w io.Writer, size int,
+	closer func() error) io.WriteCloser {
+	if size <= 0 {
+		return unbufferedOutput{w, closer}
+	}
+	b := &bufferedOutput{w: bufio.NewWriterSize(w, size), closer: closer,
+		done: make(chan struct{}), stopped: make(chan struct{})}
+	go b.flushEvery(flush_interval)
+	return b
+}
+
+// Flushes the buffer every interval until Close is called.
+func (b *bufferedOutput) flushEvery(interval time.Duration) {
+	defer close(b.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			if err := b.w.Flush(); err != nil && b.err == nil {
+				b.err = err
+			}
+			b.mu.Unlock()
+		}
+	}
+}
+
+// Writes p to the buffer.
+func (b *bufferedOutput) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.w.Write(p)
+}
+
+// Stops the flushes, flushes the buffer and closes the underlying
+// writer.
+func (b *bufferedOutput) Close() error {
+	close(b.done)
+	<-b.stopped
+	err := b.err
+	if ferr := b.w.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := b.closer(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// A writer without a buffer that is closed by calling closer.
+type unbufferedOutput struct {
+	io.Writer
+	closer func() error
+}
+
+// Calls closer.
+func (u unbufferedOutput) Close() error {
+	return u.closer()
+}
+
+// Opens the file that the reports are written to, or standard output if
+// there is no name.
+func openOutput(name string, buffer_size int) (io.Writer, func() error,
+	error) {
+	w, closer, err := openFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := newBufferedOutput(w, buffer_size, closer)
+	return out, out.Close, nil
+}
+
+// Opens the named file, or standard output if there is no name, as for
+// openOutput but without a buffer.
+func openFile(name string) (io.Writer, func() error, error) {
+	if name == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return f, f.Close, nil
+	}
+	zw := gzip.NewWriter(f)
+	closer := func() error {
+		err := zw.Close()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	return zw, closer, nil
+}
+
+// Returns a logger that writes to standard error in the given format at
+// the given level.
+func newLogger(format string, level string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log_level: %v", err)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "":
+		return nil, nil
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+	return nil, fmt.Errorf("log must be text or json, got %q", format)
+}
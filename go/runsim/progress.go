@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"nathangeffen/abm"
+)
+
+// How often the progress of a batch is shown.
+const progress_interval = 250 * time.Millisecond
+
+// Shows the progress of the batch on standard error until the returned
+// function is called.
+func showProgress(b *abm.BatchParams) func() {
+	var iterations, completed atomic.Int64
+	b.IterationCounter = &iterations
+	b.Progress = func(n int) {
+		completed.Store(int64(n))
+	}
+	total := int64(b.Simulations) * int64(b.Iterations)
+	start := time.Now()
+	show := func() {
+		done := iterations.Load()
+		line := fmt.Sprintf("\rCompleted %d of %d iterations, %d of %d "+
+			"simulations", done, total, completed.Load(), b.Simulations)
+		if done > 0 && done < total {
+			left := time.Duration(float64(time.Since(start)) *
+				float64(total - done) / float64(done))
+			line += fmt.Sprintf(", about %v left", left.Round(time.Second))
+		}
+		// Cleared to the end of the line, as the estimate shortens.
+		fmt.Fprint(os.Stderr, line + "\x1b[K")
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(progress_interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				show()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+		show()
+		fmt.Fprintln(os.Stderr)
+	}
+}
@@ -1,8 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"sync"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 	"nathangeffen/abm"
 )
 
@@ -11,58 +21,579 @@ type parameters struct {
 	simulations int
 	iterations int
 	infections int
+	cluster_infections bool
+	contact_sigma float64
 	agents int
 	events int
+	transmission_prob float64
+	poisson_events bool
+	infection_model string
+	transmission_rate float64
+	network_degree int
+	network_rewire float64
+	space_size float64
+	contact_radius float64
+	move_step float64
+	household_min int
+	household_max int
+	household_rate float64
 	growth float64
+	max_agents int
+	vaccination_rate float64
+	incubation_rate float64
+	detection_rate float64
+	trace_memory int
+	trace_prob float64
+	recovery_rate float64
+	waning_rate float64
+	reinfection_factor float64
+	immunity float64
+	seasonal_amplitude float64
+	seasonal_period float64
 	death_rate_susceptible float64
 	death_rate_infected float64
+	death_rates string
+	background_death_rate float64
+	comorbid_fraction float64
+	comorbid_death_multiplier float64
+	death_time_shape float64
+	death_time_scale float64
+	csv bool
+	jsonl bool
+	report_interval int
+	precision int
+	out string
+	buffer_size int
+	split_output string
+	json_out string
+	json_agents bool
+	workers int
+	seed int64
+	// Whether seed was given, on the command line or in a config file.
+	seeded bool
+	// The parameters given in a config file or request, by name.
+	given map[string]bool
+	progress bool
+	verbose bool
+	log string
+	log_level string
+	stop_when_extinct bool
+	sweep string
+	validate bool
 }
 
 
-// Process the command line arguments and return values set in
-// parameters struct.
-func processFlags() parameters {
-	var p parameters
-	flag.IntVar(&p.simulations, "simulations", 10,
+// Defines the command line flags on fs, storing their values in p.
+func defineFlags(fs *flag.FlagSet, p *parameters) {
+	fs.IntVar(&p.simulations, "simulations", 10,
 		"number of simulations")
-	flag.IntVar(&p.iterations, "iterations", 365 * 4,
+	fs.IntVar(&p.iterations, "iterations", 365 * 4,
 		"number of iterations")
-	flag.IntVar(&p.infections, "infections", 10,
+	fs.IntVar(&p.infections, "infections", 10,
 		"initial infections")
-	flag.IntVar(&p.agents, "agents", 10000,
+	fs.BoolVar(&p.cluster_infections, "cluster_infections", false,
+		"seed the initial infections in one cluster of households, or "+
+		"of consecutive agents, instead of at random")
+	fs.Float64Var(&p.contact_sigma, "contact_sigma", 0.0,
+		"sigma of the lognormal distribution, with mean 1, of the "+
+		"agents' contact rates; 0 for uniform mixing")
+	fs.IntVar(&p.agents, "agents", 10000,
 		"number of agents")
-	flag.IntVar(&p.events, "events", 20,
+	fs.IntVar(&p.events, "events", 20,
 		"number of potential infections per iteration to simulate")
-	flag.Float64Var(&p.growth,  "growth", 0.0001,
+	fs.Float64Var(&p.transmission_prob, "transmission_prob", 1.0,
+		"probability that a contact between an infected and a "+
+		"susceptible agent transmits the infection")
+	fs.BoolVar(&p.poisson_events, "poisson_events", false,
+		"draw the number of events per iteration from a Poisson "+
+		"distribution with mean -events")
+	fs.StringVar(&p.infection_model, "infection_model", "events",
+		"infection algorithm: \"events\" for random contacts, \"rate\" "+
+		"for mass action at -transmission_rate, \"network\" for "+
+		"contacts on a small-world network of -network_degree, or "+
+		"\"spatial\" for contacts within -contact_radius in a square "+
+		"of -space_size")
+	fs.Float64Var(&p.transmission_rate, "transmission_rate", 0.0,
+		"transmission rate of the rate infection model")
+	fs.IntVar(&p.network_degree, "network_degree", 0,
+		"mean number of neighbours of each agent in the network "+
+		"infection model")
+	fs.Float64Var(&p.network_rewire, "network_rewire", 0.1,
+		"probability that each edge of the small-world network is "+
+		"rewired to a random agent")
+	fs.Float64Var(&p.space_size, "space_size", 0.0,
+		"side of the square the agents live in for the spatial "+
+		"infection model")
+	fs.Float64Var(&p.contact_radius, "contact_radius", 0.0,
+		"distance within which agents have contact in the spatial "+
+		"infection model")
+	fs.Float64Var(&p.move_step, "move_step", 1.0,
+		"distance each living agent moves in a random direction every "+
+		"iteration of the spatial infection model (0 keeps them still)")
+	fs.IntVar(&p.household_min, "household_min", 0,
+		"smallest household size, 0 for no households")
+	fs.IntVar(&p.household_max, "household_max", 0,
+		"largest household size")
+	fs.Float64Var(&p.household_rate, "household_rate", 0.0,
+		"probability per iteration that an infected agent infects each "+
+		"member of its household")
+	fs.Float64Var(&p.growth, "growth", 0.0001,
 		"population growth per iteration")
-	flag.Float64Var(&p.death_rate_susceptible, "death_rate_susceptible",
+	fs.IntVar(&p.max_agents, "max_agents", 0,
+		"maximum number of agents, living and dead, that growth can "+
+		"reach (0 for no limit)")
+	fs.Float64Var(&p.vaccination_rate, "vaccination_rate", 0.0,
+		"fraction of the population vaccinated per iteration")
+	fs.Float64Var(&p.incubation_rate, "incubation_rate", 1.0,
+		"probability per iteration that an exposed agent becomes infectious")
+	fs.Float64Var(&p.detection_rate, "detection_rate", 0.0,
+		"probability per iteration that an infected agent is quarantined")
+	fs.IntVar(&p.trace_memory, "trace_memory", 0,
+		"number of recent contacts remembered per agent for contact "+
+		"tracing, 0 to turn tracing off")
+	fs.Float64Var(&p.trace_prob, "trace_prob", 0.0,
+		"probability that an exposed or infected contact of a "+
+		"quarantined agent is traced and quarantined")
+	fs.Float64Var(&p.recovery_rate, "recovery_rate", 0.0,
+		"probability per iteration that an infected agent recovers")
+	fs.Float64Var(&p.waning_rate, "waning_rate", 0.0,
+		"probability per iteration that a recovered agent becomes susceptible")
+	fs.Float64Var(&p.reinfection_factor, "reinfection_factor", 0.0,
+		"susceptibility of recovered agents relative to susceptible "+
+		"agents, from 0 (full immunity) to 1 (no protection)")
+	fs.Float64Var(&p.immunity, "immunity", 0.0,
+		"immunity from 0 to 1 that recovery gives, which decays at the "+
+		"waning rate and reduces susceptibility; 0 turns it off")
+	fs.Float64Var(&p.seasonal_amplitude, "seasonal_amplitude", 0.0,
+		"amplitude of the sinusoidal seasonal forcing of transmission, "+
+		"0 for none")
+	fs.Float64Var(&p.seasonal_period, "seasonal_period", 365.0,
+		"period in iterations of the seasonal forcing")
+	fs.Float64Var(&p.death_rate_susceptible, "death_rate_susceptible",
 		0.0001, "death rate for susceptible agents per iteration")
-	flag.Float64Var(&p.death_rate_infected, "death_rate_infected",
+	fs.Float64Var(&p.death_rate_infected, "death_rate_infected",
 		0.001, "death rate for infected agents per iteration")
+	fs.StringVar(&p.death_rates, "death_rates", "",
+		"comma separated death rates per iteration for individual "+
+		"states, e.g. \"Exposed=0.0005,Quarantined=0.0005\", overriding "+
+		"-death_rate_susceptible and -death_rate_infected")
+	fs.Float64Var(&p.background_death_rate, "background_death_rate", 0.0,
+		"probability per iteration that any living agent dies of causes "+
+		"other than the disease, on top of the state death rates")
+	fs.Float64Var(&p.comorbid_fraction, "comorbid_fraction", 0.0,
+		"fraction of agents with a comorbidity, 0 to turn it off")
+	fs.Float64Var(&p.comorbid_death_multiplier,
+		"comorbid_death_multiplier", 1.0,
+		"factor by which a comorbidity multiplies an agent's death rate")
+	fs.Float64Var(&p.death_time_shape, "death_time_shape", 0.0,
+		"shape of the gamma distributed time from infection to death, "+
+		"which replaces the infected death rate; 0 to turn it off")
+	fs.Float64Var(&p.death_time_scale, "death_time_scale", 0.0,
+		"scale in iterations of the gamma distributed time from "+
+		"infection to death")
+	fs.BoolVar(&p.csv, "csv", false,
+		"write reports as comma separated values")
+	fs.BoolVar(&p.jsonl, "jsonl", false,
+		"write reports as one JSON object per line")
+	fs.IntVar(&p.report_interval, "report_interval", 100,
+		"iterations between reports, 0 to report only at the end")
+	fs.IntVar(&p.precision, "precision", -1,
+		"decimal places of the floating point values in text and CSV "+
+		"reports, -1 for as many as needed")
+	fs.StringVar(&p.out, "out", "",
+		"file to write the reports to instead of standard output, "+
+		"compressed with gzip if the name ends in .gz")
+	fs.IntVar(&p.buffer_size, "buffer_size", 64 * 1024,
+		"size in bytes of the buffer for each report output, which is "+
+		"flushed at least every second, 0 to write reports unbuffered")
+	fs.StringVar(&p.split_output, "split_output", "",
+		"directory to write each simulation's reports to, in its own "+
+		"file sim_<id>.csv, .jsonl or .txt, instead of one stream")
+	fs.StringVar(&p.json_out, "json_out", "",
+		"directory to write each simulation's final state to as JSON")
+	fs.BoolVar(&p.json_agents, "json_agents", false,
+		"include every agent in the JSON output")
+	fs.IntVar(&p.workers, "workers", runtime.NumCPU(),
+		"number of simulations to run at the same time")
+	fs.Int64Var(&p.seed, "seed", 0,
+		"base random seed; simulation i is seeded with seed+i so that "+
+		"the whole batch is reproducible (if it is not given, from "+
+		"the clock)")
+	fs.BoolVar(&p.progress, "progress", false,
+		"show the number of completed iterations and simulations, and "+
+		"an estimate of the time left, on standard error")
+	fs.BoolVar(&p.verbose, "verbose", false,
+		"log the time spent in each phase of the simulations on "+
+		"standard error every report interval")
+	fs.StringVar(&p.log, "log", "",
+		"also log the reports, and at the debug level the time spent "+
+		"in each phase, to standard error with a text or json handler")
+	fs.StringVar(&p.log_level, "log_level", "info",
+		"lowest level logged with -log: debug, info, warn or error")
+	fs.BoolVar(&p.stop_when_extinct, "stop_when_extinct", false,
+		"stop each simulation once no agent is exposed or infected")
+	fs.StringVar(&p.sweep, "sweep", "",
+		"space separated parameters to sweep, each of the form "+
+		"name=value,..., e.g. \"growth=0.0001,0.0002 events=10,20\"; "+
+		"a batch is run for every combination of values")
+}
+
+// Process the command line arguments and return values set in
+// parameters struct.
+func processFlags() parameters {
+	var p parameters
+	var config string
+	var validate bool
+	defineFlags(flag.CommandLine, &p)
+	flag.StringVar(&config, "config", "",
+		"JSON file of parameters, keyed by flag name")
+	flag.BoolVar(&validate, "validate", false,
+		"check the parameters and print them as a config file without "+
+		"running any simulations")
 	flag.Parse()
+	if config != "" {
+		c, err := loadConfig(config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "runsim:", err)
+			os.Exit(2)
+		}
+		p = c
+		// Parse again so that the command line takes precedence.
+		flag.Parse()
+	}
+	if p.workers < 1 {
+		p.workers = 1
+	}
+	flag.Visit(func(f *flag.Flag) {
+		p.seeded = p.seeded || f.Name == "seed"
+	})
+	if !p.seeded {
+		p.seed = time.Now().UnixNano()
+	}
+	p.validate = validate
 	return p
 }
 
+// Writes the final state of simulation sim_num to sim_<sim_num>.json in
+// the given directory.
+func writeJSON(dir string, sim_num int, s *abm.Simulation,
+	include_agents bool) error {
+	name := filepath.Join(dir, fmt.Sprintf("sim_%d.json", sim_num))
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = s.ExportJSON(f, include_agents)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Creates the file in p.split_output that simulation sim_num reports
+// to, named for the report format, starting with the header for CSV.
+func openSplitOutput(p *parameters, sim_num int) (io.WriteCloser, error) {
+	ext := "txt"
+	if p.csv {
+		ext = "csv"
+	} else if p.jsonl {
+		ext = "jsonl"
+	}
+	name := filepath.Join(p.split_output,
+		fmt.Sprintf("sim_%d.%s", sim_num, ext))
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	out := newBufferedOutput(f, p.buffer_size, f.Close)
+	if p.csv {
+		abm.ReportCSVHeader(out)
+	}
+	return out, nil
+}
+
+// Converts the command line parameters to the settings of a batch run.
+func batchParams(p *parameters) abm.BatchParams {
+	b := abm.BatchParams{
+		Simulations: p.simulations,
+		Iterations: p.iterations,
+		Agents: p.agents,
+		Infections: p.infections,
+		Workers: p.workers,
+		Seed: p.seed,
+		Parameters: abm.Parameters{
+			Growth: p.growth,
+			Events: p.events,
+			HouseholdRate: p.household_rate,
+			VaccinationRate: p.vaccination_rate,
+			IncubationRate: p.incubation_rate,
+			DetectionRate: p.detection_rate,
+			TraceProbability: p.trace_prob,
+			RecoveryRate: p.recovery_rate,
+			WaningRate: p.waning_rate,
+			DeathRates: deathRates(p),
+			BackgroundDeathRate: p.background_death_rate,
+			StopWhenExtinct: p.stop_when_extinct,
+		},
+		Options: []abm.Option{
+			abm.WithReinfection(p.reinfection_factor),
+			abm.WithImmunity(p.immunity),
+			abm.WithComorbidity(p.comorbid_fraction,
+				p.comorbid_death_multiplier),
+			abm.WithTransmissionProbability(p.transmission_prob),
+			func(s *abm.Simulation) { s.SetPrecision(p.precision) },
+			abm.WithMaxAgents(p.max_agents),
+			abm.WithContactTracing(p.trace_memory),
+		},
+		ReportInterval: p.report_interval,
+	}
+	if p.poisson_events {
+		b.Parameters.EventsDistribution = abm.PoissonEvents(
+			float64(p.events))
+	}
+	if p.infection_model == "spatial" {
+		b.Options = append(b.Options, abm.WithSpace(p.space_size))
+	}
+	if p.death_time_shape > 0.0 {
+		b.Options = append(b.Options, abm.WithDeathTimes(
+			abm.Gamma(p.death_time_shape, p.death_time_scale)))
+	}
+	if p.contact_sigma > 0.0 {
+		sigma := p.contact_sigma
+		b.Options = append(b.Options, abm.WithContactRates(
+			abm.LogNormal(-sigma * sigma / 2.0, sigma)))
+	}
+	if p.cluster_infections {
+		b.Options = append(b.Options, abm.WithClusteredInfections())
+	}
+	if p.household_min > 0 {
+		b.Options = append(b.Options, abm.WithHouseholds(
+			abm.UniformHouseholdSizes(p.household_min, p.household_max)))
+	}
+	if p.seasonal_amplitude > 0.0 {
+		b.Options = append(b.Options, abm.WithSeasonality(
+			abm.SinusoidalSeasonality(p.seasonal_amplitude,
+				p.seasonal_period)))
+	}
+	if p.csv {
+		b.Format = abm.CSV
+	} else if p.jsonl {
+		b.Format = abm.JSONL
+	}
+	if p.split_output != "" {
+		b.OpenOutput = func(sim_num int) (io.WriteCloser, error) {
+			return openSplitOutput(p, sim_num)
+		}
+	}
+	if p.json_out != "" {
+		b.Finished = func(sim_num int, s *abm.Simulation) error {
+			return writeJSON(p.json_out, sim_num, s, p.json_agents)
+		}
+	}
+	// Last, as the strategies are built from the final parameters.
+	b.Parameters.Strategies = infectionStrategies(p, b.Parameters)
+	if p.verbose {
+		b.TimingLog = os.Stderr
+	}
+	// Validated beforehand.
+	b.Logger, _ = newLogger(p.log, p.log_level)
+	return b
+}
+
+// Parses a list of per-state death rates such as
+// "Exposed=0.0005,Quarantined=0.0005".
+func parseDeathRates(spec string) (map[abm.State]float64, error) {
+	rates := make(map[abm.State]float64)
+	if spec == "" {
+		return rates, nil
+	}
+	for _, field := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("death_rates: %q is not of the form "+
+				"state=rate", field)
+		}
+		state, err := abm.ParseState(strings.TrimSpace(name))
+		if err != nil {
+			return nil, fmt.Errorf("death_rates: %v", err)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("death_rates: %v", err)
+		}
+		rates[state] = rate
+	}
+	return rates, nil
+}
+
+// Returns the death rate of each state
+func deathRates(p *parameters) map[abm.State]float64 {
+	rates := abm.SusceptibleInfectedDeathRates(p.death_rate_susceptible,
+		p.death_rate_infected)
+	overrides, _ := parseDeathRates(p.death_rates)
+	for state, rate := range overrides {
+		rates[state] = rate
+	}
+	return rates
+}
+
+// Returns the mean and sample standard deviation of values.
+func meanSD(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0.0, 0.0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if len(values) == 1 {
+		return mean, 0.0
+	}
+	ss := 0.0
+	for _, v := range values {
+		ss += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(ss / float64(len(values) - 1))
+}
+
+// Writes the mean and standard deviation across simulations of the
+// final number of susceptible, infected and dead agents.
+func summarize(w io.Writer, results []abm.Stats) {
+	counts := []struct {
+		name string
+		count func(st abm.Stats) int
+	}{
+		{"Susceptible", func(st abm.Stats) int { return st.Susceptible }},
+		{"Infected", func(st abm.Stats) int { return st.Infected }},
+		{"Dead", func(st abm.Stats) int { return st.Dead }},
+	}
+	fmt.Fprintln(w, "Summary of", len(results), "simulations:")
+	values := make([]float64, len(results))
+	for _, c := range counts {
+		for i, st := range results {
+			values[i] = float64(c.count(st))
+		}
+		mean, sd := meanSD(values)
+		fmt.Fprintf(w, "%s mean: %.2f sd: %.2f\n", c.name, mean, sd)
+	}
+}
+
 // Gets the command line arguments and then executes in parallel the
-// specified number of simulations.  Note that it uses a standard
-// library WaitGroup to manage the parallel processing. See Go by
-// Example to see the WaitGroup pattern. Note that unlike the Python
-// and C++ versions, we provide absolutely nothing about the number of
-// cores. WaitGroup presumably works that all out.
+// specified number of simulations with abm.RunBatch, for every
+// combination of swept parameters. Run as "runsim serve", it instead
+// serves simulations over HTTP.
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve(os.Args[2:])
+		return
+	}
 	p := processFlags()
-	var wg sync.WaitGroup
-	for i := 0; i < p.simulations; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			func(sim_num int, p *parameters) {
-				s := abm.NewSimulation(sim_num, p.agents, p.infections)
-				s.Simulate(p.iterations, p.growth, p.events,
-					p.death_rate_susceptible, p.death_rate_infected)
-				s.Report(p.iterations)
-			}(i, &p)
-		}()
-	}
-	wg.Wait()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	axes, err := parseSweep(p.sweep)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "runsim:", err)
+		os.Exit(2)
+	}
+	combinations := product(axes)
+	sets := make([]parameters, len(combinations))
+	for k, settings := range combinations {
+		sets[k], err = applySettings(p, settings)
+		if err == nil {
+			err = validate(&sets[k])
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "runsim:", err)
+			os.Exit(2)
+		}
+		if sets[k].json_out != "" && len(axes) > 0 {
+			sets[k].json_out = filepath.Join(sets[k].json_out,
+				fmt.Sprintf("sweep_%d", k))
+		}
+		if sets[k].split_output != "" && len(axes) > 0 {
+			sets[k].split_output = filepath.Join(sets[k].split_output,
+				fmt.Sprintf("sweep_%d", k))
+		}
+	}
+	if p.validate {
+		if err := printConfig(os.Stdout, p); err != nil {
+			fmt.Fprintln(os.Stderr, "runsim:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	out, closeOutput, err := openOutput(p.out, p.buffer_size)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "runsim:", err)
+		os.Exit(1)
+	}
+	if p.csv && p.split_output == "" {
+		abm.ReportCSVHeader(tagHeader(out, combinations[0]))
+	}
+	// Through the output buffer when the reports are on standard output
+	// too, so that the two stay in order.
+	summary := io.Writer(os.Stdout)
+	if p.out == "" {
+		summary = out
+	}
+	if p.csv || p.jsonl {
+		summary = os.Stderr
+	}
+	start := time.Now()
+	// The totals of the final statistics over every batch.
+	var totals abm.Metrics
+	for k, settings := range combinations {
+		q := &sets[k]
+		dirs := []string{q.json_out, q.split_output}
+		for _, dir := range dirs {
+			if dir == "" {
+				continue
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				closeOutput()
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		b := batchParams(q)
+		b.Output = tagSettings(out, settings, q)
+		stop_progress := func() {}
+		if q.progress {
+			stop_progress = showProgress(&b)
+		}
+		all, err := abm.RunBatch(ctx, b)
+		stop_progress()
+		if err != nil && ctx.Err() == nil {
+			// Keep the reports written before the error.
+			closeOutput()
+			fmt.Fprintln(os.Stderr, "runsim:", err)
+			os.Exit(1)
+		}
+		if len(settings) > 0 {
+			fmt.Fprint(summary, "Parameters:")
+			for _, s := range settings {
+				fmt.Fprintf(summary, " %s=%s", s.name, s.value)
+			}
+			fmt.Fprintln(summary)
+		}
+		summarize(summary, all)
+		for _, st := range all {
+			totals.Simulations++
+			totals.Infected += st.Infected
+			totals.Dead += st.Dead
+			totals.CumulativeInfections += st.CumulativeInfections
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if err := closeOutput(); err != nil {
+		fmt.Fprintln(os.Stderr, "runsim:", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "runsim: %d simulations in %v, finishing with "+
+		"%d infected, %d dead and %d cumulative infections in total\n",
+		totals.Simulations, time.Since(start).Round(time.Millisecond),
+		totals.Infected, totals.Dead, totals.CumulativeInfections)
 }
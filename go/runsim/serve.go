@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+	"nathangeffen/abm"
+)
+
+// The largest request body the server accepts.
+const maxRequestSize = 1 << 20
+
+// The largest batch that a request may ask for.
+type serveLimits struct {
+	simulations int
+	agents int
+	iterations int
+	events int
+}
+
+// The parameters that a request may not set: those of runsim's own
+// output, which the server does not write, and workers, which it sets.
+var serveIgnored = []string{"csv", "jsonl", "report_interval", "precision",
+	"out", "buffer_size", "split_output", "json_out", "json_agents",
+	"workers", "progress", "verbose", "log", "log_level", "sweep",
+	"validate"}
+
+// Runs the serve subcommand, which runs the simulations POSTed as JSON
+// parameters to /simulate and responds with their histories.
+func serve(args []string) {
+	fs := flag.NewFlagSet("runsim serve", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	var limits serveLimits
+	fs.IntVar(&limits.simulations, "limit_simulations", 100,
+		"most simulations a request may run")
+	fs.IntVar(&limits.agents, "limit_agents", 1000000,
+		"most agents a simulation may have, including those from growth")
+	fs.IntVar(&limits.iterations, "limit_iterations", 10000,
+		"most iterations a simulation may run")
+	fs.IntVar(&limits.events, "limit_events", 1000000,
+		"most infection events a simulation may have per iteration")
+	fs.Parse(args)
+	http.HandleFunc("/simulate", func(w http.ResponseWriter,
+		r *http.Request) {
+		handleSimulate(w, r, limits)
+	})
+	fmt.Fprintln(os.Stderr, "runsim: listening on", *addr)
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		fmt.Fprintln(os.Stderr, "runsim:", err)
+		os.Exit(1)
+	}
+}
+
+// Runs the simulations described by the body of a POST request and
+// writes their histories as the response.
+func handleSimulate(w http.ResponseWriter, r *http.Request,
+	limits serveLimits) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, maxRequestSize)
+	p, err := decodeConfig("request", body)
+	if err == nil {
+		err = validate(&p)
+	}
+	if err == nil {
+		err = limits.check(&p)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !p.seeded {
+		p.seed = time.Now().UnixNano()
+	}
+	b := batchParams(&p)
+	b.Options = append(b.Options, func(s *abm.Simulation) {
+		s.EnableHistory()
+	})
+	histories := make([][]abm.Stats, p.simulations)
+	// Each simulation only writes its own entry, so no lock is needed.
+	b.Finished = func(sim_num int, s *abm.Simulation) error {
+		histories[sim_num] = s.History()
+		return nil
+	}
+	if _, err := abm.RunBatch(r.Context(), b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(histories)
+}
+
+// Checks that the request's parameters are within the limits. Growth
+// is capped at the agent limit if the request does not cap it lower.
+func (l serveLimits) check(p *parameters) error {
+	for _, name := range serveIgnored {
+		if p.given[name] {
+			return fmt.Errorf("parameter %q is not supported by the server",
+				name)
+		}
+	}
+	counts := []struct {
+		name string
+		value int
+		limit int
+	}{
+		{"simulations", p.simulations, l.simulations},
+		{"agents", p.agents, l.agents},
+		{"max_agents", p.max_agents, l.agents},
+		{"iterations", p.iterations, l.iterations},
+		{"events", p.events, l.events},
+	}
+	for _, c := range counts {
+		if c.value > c.limit {
+			return fmt.Errorf("%s must be at most %d, got %d", c.name,
+				c.limit, c.value)
+		}
+	}
+	if p.max_agents == 0 {
+		p.max_agents = l.agents
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A value given to a parameter in a sweep.
+type setting struct {
+	name string
+	value string
+}
+
+// Parses a sweep specification such as "growth=0.0001,0.0002
+// events=10,20" into the values of each swept parameter.
+func parseSweep(spec string) ([][]setting, error) {
+	var axes [][]setting
+	seen := make(map[string]bool)
+	for _, field := range strings.Fields(spec) {
+		name, values, ok := strings.Cut(field, "=")
+		if !ok || name == "" || values == "" {
+			return nil, fmt.Errorf("sweep: %q is not of the form "+
+				"name=value,...", field)
+		}
+		if name == "sweep" {
+			return nil, fmt.Errorf("sweep: cannot sweep %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("sweep: %q given more than once", name)
+		}
+		seen[name] = true
+		var axis []setting
+		for _, value := range strings.Split(values, ",") {
+			axis = append(axis, setting{name, value})
+		}
+		axes = append(axes, axis)
+	}
+	return axes, nil
+}
+
+// Returns every combination of one value from each axis, varying the
+// last axis fastest. With no axes there is a single, empty combination.
+func product(axes [][]setting) [][]setting {
+	combinations := [][]setting{nil}
+	for _, axis := range axes {
+		var next [][]setting
+		for _, c := range combinations {
+			for _, v := range axis {
+				next = append(next, append(c[:len(c):len(c)], v))
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// Returns a copy of p with the given settings applied as if they had
+// been given on the command line.
+func applySettings(p parameters, settings []setting) (parameters,
+	error) {
+	var q parameters
+	fs := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	defineFlags(fs, &q)
+	// The flags point into q, so they now update a copy of p.
+	q = p
+	for _, s := range settings {
+		if fs.Lookup(s.name) == nil {
+			return q, fmt.Errorf("sweep: unknown parameter %q", s.name)
+		}
+		if err := fs.Set(s.name, s.value); err != nil {
+			return q, fmt.Errorf("sweep: parameter %q: %v", s.name, err)
+		}
+	}
+	return q, nil
+}
+
+// A writer that tags every line written to it with a parameter set
+type tagWriter struct {
+	w io.Writer
+	tag []byte
+	// If true, each line is a JSON object and the tag holds the start of
+	// an object, including its opening brace, that replaces the line's
+	// opening brace.
+	json bool
+}
+
+// Writes p to the underlying writer with the tag in front of it.
+func (t tagWriter) Write(p []byte) (int, error) {
+	line := append([]byte(nil), t.tag...)
+	if t.json && len(p) > 0 && p[0] == '{' {
+		line = append(line, p[1:]...)
+	} else {
+		line = append(line, p...)
+	}
+	if _, err := t.w.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Returns a writer that tags each line written to w with the settings,
+// in the form matching the output format.
+func tagSettings(w io.Writer, settings []setting, p *parameters) io.Writer {
+	if len(settings) == 0 {
+		return w
+	}
+	var b strings.Builder
+	switch {
+	case p.csv:
+		for _, s := range settings {
+			b.WriteString(s.value + ",")
+		}
+	case p.jsonl:
+		// The values are set on flags of their own, which have already
+		// accepted them, so that they are written as their flag's type.
+		var q parameters
+		fs := flag.NewFlagSet("tag", flag.ContinueOnError)
+		defineFlags(fs, &q)
+		b.WriteString("{")
+		for _, s := range settings {
+			fs.Set(s.name, s.value)
+			name, _ := json.Marshal(s.name)
+			value := flagJSON(fs.Lookup(s.name))
+			b.WriteString(string(name) + ":" + string(value) + ",")
+		}
+	default:
+		for _, s := range settings {
+			b.WriteString(s.name + "=" + s.value + " ")
+		}
+	}
+	return tagWriter{w: w, tag: []byte(b.String()), json: p.jsonl}
+}
+
+// Returns a writer that puts the names of the swept parameters in
+// front of the CSV header line written to w.
+func tagHeader(w io.Writer, settings []setting) io.Writer {
+	var b strings.Builder
+	for _, s := range settings {
+		b.WriteString(s.name + ",")
+	}
+	return tagWriter{w: w, tag: []byte(b.String())}
+}
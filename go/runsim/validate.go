@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Checks that the parameters make sense, returning an error describing
+// the first one that does not.
+func validate(p *parameters) error {
+	counts := []struct {
+		name string
+		value int
+	}{
+		{"simulations", p.simulations},
+		{"iterations", p.iterations},
+		{"agents", p.agents},
+		{"infections", p.infections},
+		{"events", p.events},
+		{"max_agents", p.max_agents},
+		{"trace_memory", p.trace_memory},
+		{"report_interval", p.report_interval},
+		{"buffer_size", p.buffer_size},
+	}
+	for _, c := range counts {
+		if c.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", c.name,
+				c.value)
+		}
+	}
+	if p.infections > p.agents {
+		return fmt.Errorf("infections (%d) exceeds agents (%d)",
+			p.infections, p.agents)
+	}
+	if p.household_min < 0 {
+		return fmt.Errorf("household_min must not be negative, got %d",
+			p.household_min)
+	}
+	if p.household_min > 0 && p.household_max < p.household_min {
+		return fmt.Errorf("household_max (%d) is less than "+
+			"household_min (%d)", p.household_max, p.household_min)
+	}
+	if p.out != "" && p.split_output != "" {
+		return fmt.Errorf("out and split_output cannot both be set")
+	}
+	if _, err := newLogger(p.log, p.log_level); err != nil {
+		return err
+	}
+	if p.comorbid_death_multiplier < 0.0 {
+		return fmt.Errorf("comorbid_death_multiplier must not be "+
+			"negative, got %g", p.comorbid_death_multiplier)
+	}
+	if err := validateInfectionModel(p); err != nil {
+		return err
+	}
+	if p.death_time_shape < 0.0 {
+		return fmt.Errorf("death_time_shape must not be negative, got %g",
+			p.death_time_shape)
+	}
+	if p.death_time_shape > 0.0 && p.death_time_scale <= 0.0 {
+		return fmt.Errorf("death_time_scale must be positive with "+
+			"death_time_shape, got %g", p.death_time_scale)
+	}
+	if p.contact_sigma < 0.0 {
+		return fmt.Errorf("contact_sigma must not be negative, got %g",
+			p.contact_sigma)
+	}
+	if p.growth < 0.0 {
+		return fmt.Errorf("growth must not be negative, got %g", p.growth)
+	}
+	rates := []struct {
+		name string
+		value float64
+	}{
+		{"transmission_prob", p.transmission_prob},
+		{"vaccination_rate", p.vaccination_rate},
+		{"incubation_rate", p.incubation_rate},
+		{"detection_rate", p.detection_rate},
+		{"trace_prob", p.trace_prob},
+		{"recovery_rate", p.recovery_rate},
+		{"waning_rate", p.waning_rate},
+		{"reinfection_factor", p.reinfection_factor},
+		{"immunity", p.immunity},
+		{"death_rate_susceptible", p.death_rate_susceptible},
+		{"death_rate_infected", p.death_rate_infected},
+		{"background_death_rate", p.background_death_rate},
+		{"comorbid_fraction", p.comorbid_fraction},
+		{"seasonal_amplitude", p.seasonal_amplitude},
+		{"household_rate", p.household_rate},
+	}
+	if p.seasonal_period <= 0.0 {
+		return fmt.Errorf("seasonal_period must be positive, got %g",
+			p.seasonal_period)
+	}
+	for _, r := range rates {
+		if r.value < 0.0 || r.value > 1.0 {
+			return fmt.Errorf("%s must be between 0 and 1, got %g",
+				r.name, r.value)
+		}
+	}
+	death_rates, err := parseDeathRates(p.death_rates)
+	if err != nil {
+		return err
+	}
+	for state, rate := range death_rates {
+		if rate < 0.0 || rate > 1.0 {
+			return fmt.Errorf("death_rates: the rate for %v must be "+
+				"between 0 and 1, got %g", state, rate)
+		}
+	}
+	return nil
+}
+
+// Checks that the infection model is known and that the parameters it
+// needs are set.
+func validateInfectionModel(p *parameters) error {
+	switch p.infection_model {
+	case "events":
+	case "rate":
+		if p.transmission_rate <= 0.0 {
+			return fmt.Errorf("the rate infection model needs a "+
+				"positive transmission_rate, got %g", p.transmission_rate)
+		}
+	case "network":
+		if p.network_degree < 2 {
+			return fmt.Errorf("the network infection model needs a "+
+				"network_degree of at least 2, got %d", p.network_degree)
+		}
+		if p.network_rewire < 0.0 || p.network_rewire > 1.0 {
+			return fmt.Errorf("network_rewire must be between 0 and 1, "+
+				"got %g", p.network_rewire)
+		}
+	case "spatial":
+		if p.space_size <= 0.0 || p.contact_radius <= 0.0 {
+			return fmt.Errorf("the spatial infection model needs a "+
+				"positive space_size and contact_radius, got %g and %g",
+				p.space_size, p.contact_radius)
+		}
+		if p.move_step < 0.0 {
+			return fmt.Errorf("move_step must not be negative, got %g",
+				p.move_step)
+		}
+	default:
+		return fmt.Errorf("infection_model must be one of %s, got %q",
+			strings.Join(infection_models, ", "), p.infection_model)
+	}
+	return nil
+}
+
+// Writes the parameters to w as a JSON object keyed by flag name, in
+// the form read by -config.
+func printConfig(w io.Writer, p parameters) error {
+	var q parameters
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	defineFlags(fs, &q)
+	// The flags point into q, so they now report the values of p.
+	q = p
+	config := make(map[string]json.RawMessage)
+	fs.VisitAll(func(f *flag.Flag) {
+		config[f.Name] = flagJSON(f)
+	})
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// Returns the value of the flag as JSON, quoted if the flag is a string
+// flag or its value is not a JSON number or boolean.
+func flagJSON(f *flag.Flag) json.RawMessage {
+	value := f.Value.String()
+	if g, ok := f.Value.(flag.Getter); ok {
+		if _, ok := g.Get().(string); !ok && json.Valid([]byte(value)) {
+			return json.RawMessage(value)
+		}
+	}
+	quoted, _ := json.Marshal(value)
+	return quoted
+}